@@ -8,5 +8,6 @@ require (
 	github.com/lecex/user v1.8.30
 	github.com/micro/go-micro/v2 v2.3.0
 	github.com/shopspring/decimal v1.3.1
+	github.com/tjfoc/gmsm v1.4.1
 	golang.org/x/crypto v0.0.0-20220126234351-aa10faf2a1f8
 )
@@ -1,12 +1,22 @@
 package handler
 
 import (
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/micro/go-micro/v2"
+	"github.com/micro/go-micro/v2/util/log"
 
 	pb "github.com/lecex/pay/proto/tradeService"
 	"github.com/lecex/user/core/env"
 
 	"github.com/lecex/vipspt/config"
+	"github.com/lecex/vipspt/service/breaker"
+	"github.com/lecex/vipspt/service/replay"
+	"github.com/lecex/vipspt/service/secret"
+	"github.com/lecex/vipspt/service/util"
 )
 
 const topic = "event"
@@ -21,8 +31,96 @@ var Conf = config.Conf
 // Register 注册
 func (srv *Handler) Register() {
 	server := srv.Service.Server()
-	pb.RegisterTradesHandler(server, &Trade{
-		NotifyUrl:  env.Getenv("PAY_NOTIFY_URL", "http://127.0.01/"),
-		PayService: env.Getenv("PAY_SERVICE", "go.micro.srv.pay"),
-	})
+	// 异步通知允许的时间窗口
+	notifyWindow, err := time.ParseDuration(env.Getenv("PAY_VIPSPT_NOTIFY_WINDOW", "24h"))
+	if err != nil {
+		notifyWindow = 24 * time.Hour
+	}
+	// 加密密钥库 主密钥为 base64 编码的 32 字节
+	var keystore *secret.Keystore
+	if path := env.Getenv("PAY_VIPSPT_KEYSTORE", ""); path != "" {
+		masterKey, err := base64.StdEncoding.DecodeString(env.Getenv("PAY_VIPSPT_MASTER_KEY", ""))
+		if err != nil {
+			log.Fatal("vipspt master key error: ", err)
+		}
+		keystore, err = secret.NewKeystore(path, masterKey, 5*time.Minute)
+		if err != nil {
+			log.Fatal("vipspt keystore error: ", err)
+		}
+	}
+	// 请求中 env: 引用允许的环境变量前缀 不得覆盖服务自身配置
+	secretEnvPrefix := env.Getenv("PAY_VIPSPT_SECRET_ENV_PREFIX", "")
+	if secretEnvPrefix != "" && (strings.HasPrefix("PAY_VIPSPT_", secretEnvPrefix) || strings.HasPrefix(secretEnvPrefix, "PAY_VIPSPT_")) {
+		log.Fatal("vipspt PAY_VIPSPT_SECRET_ENV_PREFIX must not match service settings: ", secretEnvPrefix)
+	}
+	// 平台公钥轮换过渡期截止时间 RFC3339
+	var keyOverlapUntil time.Time
+	if v := env.Getenv("PAY_VIPSPT_KEY_OVERLAP_UNTIL", ""); v != "" {
+		keyOverlapUntil, err = time.Parse(time.RFC3339, v)
+		if err != nil {
+			log.Fatal("vipspt key overlap until error: ", err)
+		}
+	}
+	// 平台公钥 异步通知转发前验签 未配置时所有通知均无法通过验证
+	publicKey := env.Getenv("PAY_VIPSPT_PUBLIC_KEY", "")
+	if publicKey == "" {
+		log.Fatal("vipspt PAY_VIPSPT_PUBLIC_KEY is empty")
+	}
+	// 旧平台公钥必须设置过渡期截止时间
+	publicKeySecondary := env.Getenv("PAY_VIPSPT_PUBLIC_KEY_SECONDARY", "")
+	if publicKeySecondary != "" && keyOverlapUntil.IsZero() {
+		log.Fatal("vipspt PAY_VIPSPT_PUBLIC_KEY_SECONDARY requires PAY_VIPSPT_KEY_OVERLAP_UNTIL")
+	}
+	// 平台签名类型 返回数据及异步通知使用平台公钥验签 不支持摘要签名类型
+	signType := env.Getenv("PAY_VIPSPT_SIGN_TYPE", "")
+	if util.SecretSignType(signType) {
+		log.Fatal("vipspt PAY_VIPSPT_SIGN_TYPE must be RSA, RSA2 or SM2: ", signType)
+	}
+	if _, err := util.NewVerifier(signType, publicKey); err != nil {
+		log.Fatal("vipspt PAY_VIPSPT_PUBLIC_KEY error: ", err)
+	}
+	// 网关熔断 所有商户共用 由运维配置
+	breakerOpts := breaker.Options{}
+	if breakerOpts.FailureThreshold, err = strconv.Atoi(env.Getenv("PAY_VIPSPT_BREAKER_FAILURE_THRESHOLD", "5")); err != nil {
+		log.Fatal("vipspt PAY_VIPSPT_BREAKER_FAILURE_THRESHOLD error: ", err)
+	}
+	if breakerOpts.HalfOpenProbes, err = strconv.Atoi(env.Getenv("PAY_VIPSPT_BREAKER_HALF_OPEN_PROBES", "1")); err != nil {
+		log.Fatal("vipspt PAY_VIPSPT_BREAKER_HALF_OPEN_PROBES error: ", err)
+	}
+	if breakerOpts.OpenTimeout, err = time.ParseDuration(env.Getenv("PAY_VIPSPT_BREAKER_OPEN_TIMEOUT", "30s")); err != nil {
+		log.Fatal("vipspt PAY_VIPSPT_BREAKER_OPEN_TIMEOUT error: ", err)
+	}
+	if breakerOpts.MinTimeout, err = time.ParseDuration(env.Getenv("PAY_VIPSPT_BREAKER_MIN_TIMEOUT", "5s")); err != nil {
+		log.Fatal("vipspt PAY_VIPSPT_BREAKER_MIN_TIMEOUT error: ", err)
+	}
+	// 网关地址 CA 证书及公钥锁定按环境由运维配置 严格模式下生产环境必须使用 https
+	production := newGateway(env.Getenv("PAY_VIPSPT_BASE_URL", ""), env.Getenv("PAY_VIPSPT_CA_BUNDLE", ""), env.Getenv("PAY_VIPSPT_PINS", ""))
+	sandbox := newGateway(env.Getenv("PAY_VIPSPT_SANDBOX_BASE_URL", ""), env.Getenv("PAY_VIPSPT_SANDBOX_CA_BUNDLE", ""), env.Getenv("PAY_VIPSPT_SANDBOX_PINS", ""))
+	strict, err := strconv.ParseBool(env.Getenv("PAY_VIPSPT_STRICT", "false"))
+	if err != nil {
+		log.Fatal("vipspt PAY_VIPSPT_STRICT error: ", err)
+	}
+	if strict && !strings.HasPrefix(production.BaseUrl, "https://") {
+		log.Fatal("vipspt PAY_VIPSPT_STRICT requires an https PAY_VIPSPT_BASE_URL: ", production.BaseUrl)
+	}
+	// 请求中 file: 密钥引用及商户证书文件路径仅允许该目录内的文件
+	secretDir := env.Getenv("PAY_VIPSPT_SECRET_DIR", "")
+	trade := &Trade{
+		NotifyUrl:          env.Getenv("PAY_NOTIFY_URL", "http://127.0.01/"),
+		PayService:         env.Getenv("PAY_SERVICE", "go.micro.srv.pay"),
+		SignType:           signType,
+		PublicKey:          publicKey,
+		PublicKeySecondary: publicKeySecondary,
+		KeyOverlapUntil:    keyOverlapUntil,
+		Replay:             replay.NewGuard(replay.NewMemoryStore(100000), notifyWindow),
+		Secrets:            secret.NewResolver(keystore, secretEnvPrefix, secretDir),
+		Breakers:           breaker.NewRegistry(breakerOpts),
+		Production:         production,
+		Sandbox:            sandbox,
+		Strict:             strict,
+		CertDir:            secretDir,
+	}
+	pb.RegisterTradesHandler(server, trade)
+	// 注册 Trades 之外的扩展接口 Trade.Close Trade.Reverse Trade.Transactions Trade.BreakerStatus
+	server.Handle(server.NewHandler(trade))
 }
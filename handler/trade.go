@@ -2,72 +2,212 @@ package handler
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/clbanning/mxj"
 	tradePB "github.com/lecex/pay/proto/trade"
 	pb "github.com/lecex/pay/proto/tradeService"
 	client "github.com/lecex/user/core/client"
+	"github.com/micro/go-micro/v2/metadata"
 	"github.com/shopspring/decimal"
 
 	"github.com/lecex/vipspt/service"
+	"github.com/lecex/vipspt/service/breaker"
+	"github.com/lecex/vipspt/service/config"
+	"github.com/lecex/vipspt/service/logger"
+	"github.com/lecex/vipspt/service/replay"
 	"github.com/lecex/vipspt/service/requests"
+	"github.com/lecex/vipspt/service/responses"
+	"github.com/lecex/vipspt/service/secret"
+	"github.com/lecex/vipspt/service/util"
 )
 
 // Trade 支付结构
 type Trade struct {
-	NotifyUrl  string
-	PayService string
+	NotifyUrl          string
+	PayService         string
+	SignType           string            // 平台签名类型 RSA(默认) RSA2 SM2 验证返回数据及异步通知
+	PublicKey          string            // 平台公钥 商户未配置 PublicKey 时使用
+	PublicKeySecondary string            // 轮换前的旧平台公钥 过渡期内同时接受
+	KeyOverlapUntil    time.Time         // 旧平台公钥过渡期截止时间 设置 PublicKeySecondary 时必填
+	Replay             *replay.Guard     // 异步通知防重放
+	Secrets            secret.Provider   // 密钥提供者 解析 SecretKey 引用
+	Breakers           *breaker.Registry // 网关熔断 为空时使用 breaker.Default
+	Production         config.Gateway    // 生产环境网关
+	Sandbox            config.Gateway    // 沙盒环境网关
+	Strict             bool              // 严格模式 生产环境禁止使用 http
+	CertDir            string            // 商户证书文件允许目录 为空时 Cert CertKey 仅接受证书内容
+	HTTPClient         util.Doer         // 为空时按商户连接配置创建 测试时可替换
 }
 
 // 初始化链接
 func (srv *Trade) NewClient(config map[string]string) (client *service.Client, err error) {
-	if v, ok := config["Appid"]; !ok && v == "" {
+	if config["Appid"] == "" {
 		return nil, fmt.Errorf("vipspt Appid is empty")
 	}
-	if v, ok := config["SecretKey"]; !ok && v == "" {
+	if config["SecretKey"] == "" {
 		return nil, fmt.Errorf("vipspt SecretKey is empty")
 	}
-	if v, ok := config["SubMerId"]; !ok && v == "" {
+	if config["SubMerId"] == "" {
 		return nil, fmt.Errorf("vipspt SubMerId is empty")
 	}
-	if v, ok := config["EnterpriseReg"]; !ok && v == "" {
+	if config["EnterpriseReg"] == "" {
 		return nil, fmt.Errorf("vipspt EnterpriseReg is empty")
 	}
-	if v, ok := config["Sandbox"]; !ok && v == "" {
+	if config["Sandbox"] == "" {
 		return nil, fmt.Errorf("vipspt Sandbox is empty")
 	}
+	// 返回数据使用平台公钥验签 商户未配置时使用服务配置的平台公钥
+	if config["PublicKey"] == "" && srv.PublicKey == "" {
+		return nil, fmt.Errorf("vipspt PublicKey is empty")
+	}
 
 	sandbox, _ := strconv.ParseBool(config["Sandbox"])
 	client = service.NewClient()
+	client.Breakers = srv.Breakers
+	client.HTTPClient = srv.HTTPClient
 	client.Config.Appid = config["Appid"]
 	client.Config.SecretKey = config["SecretKey"]
+	// SecretKey 支持 env: file: keystore: 引用
+	if srv.Secrets != nil {
+		client.Config.SecretKey, err = srv.Secrets.Secret(config["SecretKey"])
+		if err != nil {
+			return nil, err
+		}
+	}
 	client.Config.MerchantId = config["SubMerId"]
 	client.Config.EnterpriseReg = config["EnterpriseReg"]
+	client.Config.VerifySignType = srv.SignType
+	client.Config.PublicKey = config["PublicKey"]
+	client.Config.PublicKeySecondary = config["PublicKeySecondary"]
+	if v, ok := config["KeyOverlapUntil"]; ok && v != "" {
+		client.Config.KeyOverlapUntil, err = time.Parse(time.RFC3339, v)
+		if err != nil {
+			return nil, err
+		}
+	}
+	// 旧平台公钥必须设置过渡期截止时间
+	if client.Config.PublicKeySecondary != "" && client.Config.KeyOverlapUntil.IsZero() {
+		return nil, fmt.Errorf("vipspt KeyOverlapUntil is empty")
+	}
+	if client.Config.PublicKey == "" {
+		client.Config.PublicKey = srv.PublicKey
+		client.Config.PublicKeySecondary = srv.PublicKeySecondary
+		client.Config.KeyOverlapUntil = srv.KeyOverlapUntil
+	}
 	if v, ok := config["NotifyUrl"]; ok {
 		client.Config.NotifyUrl = v
 	}
+	if v, ok := config["SignType"]; ok {
+		client.Config.SignType = v
+	}
 	client.Config.Sandbox = sandbox
+	// 网关地址及 https 配置 使用运维配置 不接受请求传入
+	gateway := srv.Production
+	if sandbox {
+		gateway = srv.Sandbox
+	}
+	client.Config.BaseUrl = gateway.BaseUrl
+	client.Config.CaBundle = gateway.CaBundle
+	client.Config.Pins = gateway.Pins
+	client.Config.Strict = srv.Strict
+	// 商户客户端证书 文件路径须位于 CertDir 内
+	client.Config.CertDir = srv.CertDir
+	client.Config.Cert = config["Cert"]
+	client.Config.CertKey = config["CertKey"]
+	client.Config.CertPassword = config["CertPassword"]
+	// 连接配置 超时为 time.Duration 格式 如 5s
+	for k, d := range map[string]*time.Duration{
+		"ConnectTimeout": &client.Config.Transport.ConnectTimeout,
+		"ReadTimeout":    &client.Config.Transport.ReadTimeout,
+		"Timeout":        &client.Config.Transport.Timeout,
+		"KeepAlive":      &client.Config.Transport.KeepAlive,
+		// 重试配置
+		"RetryBaseDelay":      &client.Config.Retry.BaseDelay,
+		"RetryMaxDelay":       &client.Config.Retry.MaxDelay,
+		"RetryResolveTimeout": &client.Config.Retry.ResolveTimeout,
+		// 限流配置
+		"LimitQueueTimeout": &client.Config.Limit.QueueTimeout,
+	} {
+		if v, ok := config[k]; ok && v != "" {
+			if *d, err = time.ParseDuration(v); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if v, ok := config["MaxIdleConns"]; ok && v != "" {
+		if client.Config.Transport.MaxIdleConns, err = strconv.Atoi(v); err != nil {
+			return nil, err
+		}
+	}
+	if v, ok := config["MaxIdleConnsPerHost"]; ok && v != "" {
+		if client.Config.Transport.MaxIdleConnsPerHost, err = strconv.Atoi(v); err != nil {
+			return nil, err
+		}
+	}
+	client.Config.Transport.Proxy = config["Proxy"]
+	if v, ok := config["RetryMaxAttempts"]; ok && v != "" {
+		if client.Config.Retry.MaxAttempts, err = strconv.Atoi(v); err != nil {
+			return nil, err
+		}
+	}
+	if v, ok := config["LimitRate"]; ok && v != "" {
+		if client.Config.Limit.Rate, err = strconv.ParseFloat(v, 64); err != nil {
+			return nil, err
+		}
+	}
+	if v, ok := config["LimitBurst"]; ok && v != "" {
+		if client.Config.Limit.Burst, err = strconv.Atoi(v); err != nil {
+			return nil, err
+		}
+	}
+	if v, ok := config["LimitMaxConcurrent"]; ok && v != "" {
+		if client.Config.Limit.MaxConcurrent, err = strconv.Atoi(v); err != nil {
+			return nil, err
+		}
+	}
+	// 按接口限流 {"pay.refund":{"rate":2,"max_concurrent":1,"queue_timeout":"3s"}}
+	if v, ok := config["Limits"]; ok && v != "" {
+		if client.Config.Limits, err = parseLimits(v); err != nil {
+			return nil, err
+		}
+	}
 	return client, nil
 }
 
 // request 请求处理
-func (srv *Trade) request(request *requests.CommonRequest, req *pb.Request, res *pb.Response) (err error) {
-	client, err := srv.NewClient(req.Config)
+func (srv *Trade) request(ctx context.Context, request *requests.CommonRequest, req *pb.Request, res *pb.Response) (err error) {
+	data, err := srv.call(ctx, request, req)
 	if err != nil {
 		return err
 	}
-	response, err := client.ProcessCommonRequest(request)
+	return srv.content(data, res)
+}
+
+// call 请求并返回校验后数据 ctx 的取消及超时传递到网关请求
+func (srv *Trade) call(ctx context.Context, request *requests.CommonRequest, req *pb.Request) (data mxj.Map, err error) {
+	client, err := srv.NewClient(req.Config)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	data, err := response.GetVerifySignDataMap()
+	if request.RequestId == "" {
+		request.RequestId = requestId(ctx)
+	}
+	response, err := client.ProcessCommonRequest(ctx, request)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	return response.GetVerifySignDataMap()
+}
+
+// content 返回数据
+func (srv *Trade) content(data mxj.Map, res *pb.Response) (err error) {
 	r, err := data.Json()
 	if err != nil {
 		return err
@@ -77,10 +217,74 @@ func (srv *Trade) request(request *requests.CommonRequest, req *pb.Request, res
 }
 
 func (srv *Trade) Notify(ctx context.Context, req *pb.NotifyRequest, res *pb.NotifyResponse) (err error) {
-	get, post, _ := srv.handlerRequest(req)
+	get, post, header := srv.handlerRequest(req)
 	if v, ok := get["id"]; !ok || v == nil {
 		return fmt.Errorf("未找到id参数")
 	}
+	id := requestId(ctx)
+	if id == "" {
+		id = logger.NewRequestId()
+	}
+	// 验证通知签名 失败时不转发支付服务
+	keys := (&config.Config{
+		PublicKey:          srv.PublicKey,
+		PublicKeySecondary: srv.PublicKeySecondary,
+		KeyOverlapUntil:    srv.KeyOverlapUntil,
+	}).VerifyKeys()
+	index, err := util.VerifyDataSignKeys(post, srv.SignType, keys...)
+	if index > 0 {
+		logger.Default.Warn(id, "Vipspt[Notify]secondary public key used", logger.Fields{
+			"id":           get["id"],
+			"out_order_id": post["out_order_id"],
+		})
+	}
+	if err != nil {
+		logger.Default.Warn(id, "Vipspt[Notify]security verify sign failed", logger.Fields{
+			"id":              get["id"],
+			"out_order_id":    post["out_order_id"],
+			"x_forwarded_for": header["X-Forwarded-For"],
+			"error":           err,
+		})
+		res.StatusCode = http.StatusOK
+		res.Body = "FAIL"
+		return nil
+	}
+	// 防重放 时间窗口及 nonce 去重
+	nonce := util.InterfaceToString(post["nonce"])
+	if nonce == "" {
+		nonce = util.InterfaceToString(post["sSignature"])
+	}
+	if srv.Replay != nil {
+		// 无有效通知时间时无法校验时间窗口 拒绝通知
+		timestamp, err := notifyTime(post)
+		if err != nil {
+			logger.Default.Warn(id, "Vipspt[Notify]security notify time rejected", logger.Fields{
+				"id":           get["id"],
+				"out_order_id": post["out_order_id"],
+				"error":        err,
+			})
+			res.StatusCode = http.StatusOK
+			res.Body = "FAIL"
+			return nil
+		}
+		if err := srv.Replay.Check(timestamp, nonce); err != nil {
+			// 已处理成功的重复通知直接应答成功 不再转发
+			if errors.Is(err, replay.ErrProcessed) {
+				res.StatusCode = http.StatusOK
+				res.Body = "success"
+				return nil
+			}
+			logger.Default.Warn(id, "Vipspt[Notify]security replay rejected", logger.Fields{
+				"id":           get["id"],
+				"out_order_id": post["out_order_id"],
+				"rejected":     srv.Replay.Rejected(),
+				"error":        err,
+			})
+			res.StatusCode = http.StatusOK
+			res.Body = "FAIL"
+			return nil
+		}
+	}
 	// to json string
 	postJson, err := post.Json()
 	if err != nil {
@@ -92,6 +296,13 @@ func (srv *Trade) Notify(ctx context.Context, req *pb.NotifyRequest, res *pb.Not
 	}
 	rs := &tradePB.NotifyResponse{}
 	err = client.Call(ctx, srv.PayService, "Trades.Notify", r, rs)
+	// 处理失败时释放 nonce 允许平台重新通知
+	if srv.Replay != nil && (err != nil || rs.ReturnCode != "SUCCESS") {
+		srv.Replay.Release(nonce)
+	}
+	if srv.Replay != nil && err == nil && rs.ReturnCode == "SUCCESS" {
+		srv.Replay.Done(nonce)
+	}
 	if err != nil {
 		return err
 	}
@@ -105,20 +316,43 @@ func (srv *Trade) Notify(ctx context.Context, req *pb.NotifyRequest, res *pb.Not
 	return nil
 }
 
+// HanderNotify 解析并验证异步通知 通知原文为 Config["NotifyData"]
 func (srv *Trade) HanderNotify(ctx context.Context, req *pb.Request, res *pb.Response) (err error) {
-	return fmt.Errorf("暂不支持,HanderNotify:vipspt")
+	client, err := srv.NewClient(req.Config)
+	if err != nil {
+		return err
+	}
+	request := requests.NewCommonRequest()
+	request.ApiName = "pay.notify"
+	response := responses.NewCommonResponse(client.Config, request)
+	response.SetHttpContent([]byte(req.Config["NotifyData"]), "string")
+	data, err := response.GetVerifySignDataMap()
+	if err != nil {
+		return err
+	}
+	return srv.content(data, res)
 }
 
 func (srv *Trade) AopF2F(ctx context.Context, req *pb.Request, res *pb.Response) (err error) {
-	payWay := "WXZF"
-	// 配置参数
-	switch req.BizContent.Method {
-	case "wechat":
-		payWay = "WXZF"
-	case "alipay":
-		payWay = "ZFBZF"
+	method := req.BizContent.Method
+	switch method {
+	case "": // 未指定支付方式时根据付款码识别
+		method, err = util.AuthCodeMethod(req.BizContent.AuthCode)
+	case "wxface": // 微信刷脸 付款码为 face_code
+		method = "wechat"
+		if strings.TrimSpace(req.BizContent.AuthCode) == "" {
+			err = fmt.Errorf("vipspt face_code is empty")
+		}
 	default:
-		return fmt.Errorf("暂不支持," + req.BizContent.Method + ":vipspt")
+		err = util.CheckAuthCode(req.BizContent.AuthCode)
+	}
+	if err != nil {
+		return err
+	}
+	// 配置参数
+	payWay, ok := config.PayWay(method)
+	if !ok {
+		return fmt.Errorf("暂不支持," + method + ":vipspt")
 	}
 	totalFee, err := strconv.ParseFloat(req.BizContent.TotalFee, 64)
 	if err != nil {
@@ -137,7 +371,125 @@ func (srv *Trade) AopF2F(ctx context.Context, req *pb.Request, res *pb.Response)
 		// 交易时间 date_time:2021-06-22 13:48:55
 		"date_time": time.Now().Format("2006-01-02 15:04:05"),
 	}
-	return srv.request(request, req, res)
+	data, err := srv.call(ctx, request, req)
+	if err != nil {
+		return err
+	}
+	// 配置等待时间(秒)后 支付中的订单轮询查询结果
+	if v, ok := req.Config["WaitPayTimeout"]; ok && v != "" {
+		timeout, err := strconv.Atoi(v)
+		if err != nil {
+			return err
+		}
+		if timeout > 0 {
+			data, err = srv.waitPay(ctx, req, data, time.Duration(timeout)*time.Second)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return srv.content(data, res)
+}
+
+// 付款码支付轮询配置 测试时可调整
+var (
+	waitPayInterval    = time.Second     // 首次查询间隔 之后倍增
+	waitPayMaxInterval = 5 * time.Second // 最大查询间隔
+	reverseAttempts    = 3               // 撤销返回 recall=Y 时最多撤销次数
+)
+
+// waitPay 付款码支付中时轮询查询订单 超过等待时间后自动撤销订单
+// 撤销前至少查询一次 撤销失败时返回 *service.UnknownOutcomeError
+func (srv *Trade) waitPay(ctx context.Context, req *pb.Request, data mxj.Map, timeout time.Duration) (mxj.Map, error) {
+	deadline := time.Now().Add(timeout)
+	// 调用方超时前预留撤销订单的时间
+	if d, ok := ctx.Deadline(); ok && d.Add(-2*time.Second).Before(deadline) {
+		deadline = d.Add(-2 * time.Second)
+	}
+	// 轮询查询及撤销使用同一请求 ID 便于关联日志
+	id := requestId(ctx)
+	if id == "" {
+		id = logger.NewRequestId()
+	}
+	backoff := waitPayInterval
+	for attempt := 1; data["status"] == responses.USERPAYING || data["status"] == responses.WAITING; attempt++ {
+		wait := backoff
+		if time.Now().Add(wait).After(deadline) && attempt > 1 {
+			return srv.reversePay(ctx, req, id, data)
+		}
+		// 首次查询不超过等待时间
+		if d := time.Until(deadline); wait > d {
+			wait = d
+		}
+		if wait > 0 {
+			select {
+			case <-ctx.Done():
+				return data, ctx.Err()
+			case <-time.After(wait):
+			}
+		}
+		request := requests.NewCommonRequest()
+		request.ApiName = "pay.query"
+		request.RequestId = id
+		request.BizContent = map[string]interface{}{
+			"merchant_id":   req.Config["SubMerId"],
+			"enterpriseReg": req.Config["EnterpriseReg"],
+			"out_order_id":  req.BizContent.OutTradeNo,
+		}
+		query, err := srv.call(ctx, request, req)
+		logger.Default.Info(id, "Vipspt[waitPay]query", logger.Fields{
+			"attempt":      attempt,
+			"out_order_id": req.BizContent.OutTradeNo,
+			"status":       query["status"],
+			"error":        err,
+		})
+		if err == nil && query["return_code"] == responses.SUCCESS {
+			data = query
+		}
+		if backoff *= 2; backoff > waitPayMaxInterval {
+			backoff = waitPayMaxInterval
+		}
+	}
+	return data, nil
+}
+
+// reversePay 撤销支付中的订单 返回 recall=Y 时间隔后重新撤销
+// 撤销失败或超过 reverseAttempts 次仍需重新撤销时返回 *service.UnknownOutcomeError
+func (srv *Trade) reversePay(ctx context.Context, req *pb.Request, id string, data mxj.Map) (mxj.Map, error) {
+	request := requests.NewCommonRequest()
+	request.ApiName = "pay.reverse"
+	request.RequestId = id
+	request.BizContent = map[string]interface{}{
+		"merchant_id":   req.Config["SubMerId"],
+		"enterpriseReg": req.Config["EnterpriseReg"],
+		"out_order_id":  req.BizContent.OutTradeNo,
+	}
+	for attempt := 1; ; attempt++ {
+		reverse, err := srv.call(ctx, request, req)
+		logger.Default.Info(id, "Vipspt[waitPay]reverse", logger.Fields{
+			"attempt":      attempt,
+			"out_order_id": req.BizContent.OutTradeNo,
+			"reverse":      map[string]interface{}(reverse),
+			"error":        err,
+		})
+		if err != nil {
+			return data, &service.UnknownOutcomeError{ApiName: request.ApiName, Err: err}
+		}
+		if reverse["return_code"] != responses.SUCCESS {
+			return data, &service.UnknownOutcomeError{ApiName: request.ApiName, Err: fmt.Errorf("reverse failed: %v", reverse["return_msg"])}
+		}
+		if reverse["status"] != responses.WAITING {
+			return reverse, nil
+		}
+		if attempt >= reverseAttempts {
+			return data, &service.UnknownOutcomeError{ApiName: request.ApiName, Err: fmt.Errorf("reverse recall after %d attempts", attempt)}
+		}
+		select {
+		case <-ctx.Done():
+			return data, &service.UnknownOutcomeError{ApiName: request.ApiName, Err: ctx.Err()}
+		case <-time.After(waitPayInterval):
+		}
+	}
 }
 
 func (srv *Trade) Query(ctx context.Context, req *pb.Request, res *pb.Response) (err error) {
@@ -157,7 +509,7 @@ func (srv *Trade) Query(ctx context.Context, req *pb.Request, res *pb.Response)
 	} else {
 		request.BizContent["out_order_id"] = req.BizContent.OutTradeNo
 	}
-	return srv.request(request, req, res)
+	return srv.request(ctx, request, req, res)
 }
 
 func (srv *Trade) Refund(ctx context.Context, req *pb.Request, res *pb.Response) (err error) {
@@ -184,7 +536,7 @@ func (srv *Trade) Refund(ctx context.Context, req *pb.Request, res *pb.Response)
 		"refundMsg":      refundMsg,
 		"refund_amount":  decimal.NewFromFloat(refundFee).Div(decimal.NewFromFloat(float64(100))),
 	}
-	return srv.request(request, req, res)
+	return srv.request(ctx, request, req, res)
 }
 
 func (srv *Trade) RefundQuery(ctx context.Context, req *pb.Request, res *pb.Response) (err error) {
@@ -204,33 +556,308 @@ func (srv *Trade) RefundQuery(ctx context.Context, req *pb.Request, res *pb.Resp
 	} else {
 		request.BizContent["out_order_id"] = req.BizContent.OutRefundNo
 	}
-	return srv.request(request, req, res)
+	return srv.request(ctx, request, req, res)
+}
+
+// Close 关闭未支付订单
+func (srv *Trade) Close(ctx context.Context, req *pb.Request, res *pb.Response) (err error) {
+	// 配置参数
+	order, err := mxj.NewMapJson([]byte(req.Config["Order"]))
+	if err != nil {
+		return err
+	}
+	request := requests.NewCommonRequest()
+	request.ApiName = "pay.close"
+	request.BizContent = map[string]interface{}{
+		"merchant_id":   req.Config["SubMerId"],
+		"enterpriseReg": req.Config["EnterpriseReg"],
+	}
+	if v, ok := order["bank_trade_no"]; ok && v != nil && v != "" {
+		request.BizContent["third_order_id"] = v
+	} else {
+		request.BizContent["out_order_id"] = req.BizContent.OutTradeNo
+	}
+	return srv.request(ctx, request, req, res)
+}
+
+// Reverse 撤销订单 支付中的订单关闭,已支付的订单原路退回
+func (srv *Trade) Reverse(ctx context.Context, req *pb.Request, res *pb.Response) (err error) {
+	// 配置参数
+	order, err := mxj.NewMapJson([]byte(req.Config["Order"]))
+	if err != nil {
+		return err
+	}
+	request := requests.NewCommonRequest()
+	request.ApiName = "pay.reverse"
+	request.BizContent = map[string]interface{}{
+		"merchant_id":   req.Config["SubMerId"],
+		"enterpriseReg": req.Config["EnterpriseReg"],
+	}
+	if v, ok := order["bank_trade_no"]; ok && v != nil && v != "" {
+		request.BizContent["third_order_id"] = v
+	} else {
+		request.BizContent["out_order_id"] = req.BizContent.OutTradeNo
+	}
+	return srv.request(ctx, request, req, res)
+}
+
+// Transactions 按日期查询商户交易及退款流水 自动遍历所有分页
+// Config["StartDate"] Config["EndDate"] 格式 2006-01-02
+func (srv *Trade) Transactions(ctx context.Context, req *pb.Request, res *pb.Response) (err error) {
+	if v, ok := req.Config["StartDate"]; !ok || v == "" {
+		return fmt.Errorf("vipspt StartDate is empty")
+	}
+	if v, ok := req.Config["EndDate"]; !ok || v == "" {
+		return fmt.Errorf("vipspt EndDate is empty")
+	}
+	client, err := srv.NewClient(req.Config)
+	if err != nil {
+		return err
+	}
+	request := requests.NewCommonRequest()
+	request.ApiName = "pay.list"
+	request.BizContent = map[string]interface{}{
+		"merchant_id":   req.Config["SubMerId"],
+		"enterpriseReg": req.Config["EnterpriseReg"],
+		"start_date":    req.Config["StartDate"],
+		"end_date":      req.Config["EndDate"],
+	}
+	list, err := client.ProcessPageRequest(ctx, request)
+	if err != nil {
+		return err
+	}
+	data := mxj.New()
+	data["return_code"] = responses.SUCCESS
+	data["return_msg"] = ""
+	data["list"] = list
+	data["count"] = len(list)
+	data["channel"] = "vipspt" //渠道
+	return srv.content(data, res)
 }
 
 func (srv *Trade) JsApi(ctx context.Context, req *pb.Request, res *pb.Response) (err error) {
-	return fmt.Errorf("暂不支持,JsApi:vipspt")
+	// 配置参数
+	payWay, ok := config.PayWay(req.BizContent.Method)
+	if !ok {
+		return fmt.Errorf("暂不支持," + req.BizContent.Method + ":vipspt")
+	}
+	totalFee, err := strconv.ParseFloat(req.BizContent.TotalFee, 64)
+	if err != nil {
+		return err
+	}
+	request := requests.NewCommonRequest()
+	request.ApiName = "pay.jsapi"
+	request.BizContent = map[string]interface{}{
+		"merchant_id":   req.Config["SubMerId"],
+		"enterpriseReg": req.Config["EnterpriseReg"],
+		"pay_way":       payWay,
+		"out_order_id":  req.BizContent.OutTradeNo,                                              // 商户订单号(商户交易系统中唯一)
+		"sMchtIp":       "127.0.0.1",                                                            // 业务代码
+		"sub_openid":    req.BizContent.OpenId,                                                  // 微信 openid 或支付宝 user_id
+		"body":          req.BizContent.Title,                                                   // 商品名称
+		"notify_url":    srv.notifyUrl(req),                                                     // 异步通知地址
+		"amount":        decimal.NewFromFloat(totalFee).Div(decimal.NewFromFloat(float64(100))), // 单位为分
+		// 交易时间 date_time:2021-06-22 13:48:55
+		"date_time": time.Now().Format("2006-01-02 15:04:05"),
+	}
+	if req.BizContent.Method == "wechat" {
+		request.BizContent["sub_appid"] = req.BizContent.AppId // 公众号或小程序 appid
+	}
+	return srv.request(ctx, request, req, res)
 }
 
-// QRCode 构建自己的聚合支付
+// QRCode 动态二维码支付 未指定支付方式时构建自己的聚合支付
 func (srv *Trade) QRCode(ctx context.Context, req *pb.Request, res *pb.Response) (err error) {
-	data := mxj.New()
-	data["return_code"] = "SUCCESS"
-	data["return_msg"] = "SUCCESS"
-	data["qr_code"] = "self"
-	content, err := data.Json()
+	if req.BizContent.Method == "" {
+		data := mxj.New()
+		data["return_code"] = "SUCCESS"
+		data["return_msg"] = "SUCCESS"
+		data["qr_code"] = "self"
+		return srv.content(data, res)
+	}
+	// 配置参数
+	payWay, ok := config.PayWay(req.BizContent.Method)
+	if !ok {
+		return fmt.Errorf("暂不支持," + req.BizContent.Method + ":vipspt")
+	}
+	totalFee, err := strconv.ParseFloat(req.BizContent.TotalFee, 64)
 	if err != nil {
 		return err
 	}
-	res.Content = string(content)
-	return err
+	// 二维码有效时间 单位分钟
+	expire := "5"
+	if v, ok := req.Config["QRCodeExpire"]; ok && v != "" {
+		expire = v
+	}
+	request := requests.NewCommonRequest()
+	request.ApiName = "pay.qrcode"
+	request.BizContent = map[string]interface{}{
+		"merchant_id":   req.Config["SubMerId"],
+		"enterpriseReg": req.Config["EnterpriseReg"],
+		"pay_way":       payWay,
+		"out_order_id":  req.BizContent.OutTradeNo,                                              // 商户订单号(商户交易系统中唯一)
+		"sMchtIp":       "127.0.0.1",                                                            // 业务代码
+		"body":          req.BizContent.Title,                                                   // 商品名称
+		"notify_url":    srv.notifyUrl(req),                                                     // 异步通知地址
+		"expire_time":   expire,                                                                 // 二维码有效时间
+		"amount":        decimal.NewFromFloat(totalFee).Div(decimal.NewFromFloat(float64(100))), // 单位为分
+		// 交易时间 date_time:2021-06-22 13:48:55
+		"date_time": time.Now().Format("2006-01-02 15:04:05"),
+	}
+	return srv.request(ctx, request, req, res)
 }
 
+// OpenId 根据付款码获取用户标识 微信 openid 支付宝 buyer_id
 func (srv *Trade) OpenId(ctx context.Context, req *pb.Request, res *pb.Response) (err error) {
-	return fmt.Errorf("暂不支持,OpenId:vipspt")
+	// 未指定支付方式时根据付款码识别
+	method := req.BizContent.Method
+	if method == "" {
+		method, err = util.AuthCodeMethod(req.BizContent.AuthCode)
+	} else {
+		err = util.CheckAuthCode(req.BizContent.AuthCode)
+	}
+	if err != nil {
+		return err
+	}
+	// 配置参数
+	payWay, ok := config.PayWay(method)
+	if !ok || (method != "wechat" && method != "alipay") {
+		return fmt.Errorf("暂不支持," + method + ":vipspt")
+	}
+	request := requests.NewCommonRequest()
+	request.ApiName = "pay.openid"
+	request.BizContent = map[string]interface{}{
+		"merchant_id":   req.Config["SubMerId"],
+		"enterpriseReg": req.Config["EnterpriseReg"],
+		"pay_way":       payWay,
+		"sAuthCode":     req.BizContent.AuthCode, // 付款码
+	}
+	if method == "wechat" {
+		request.BizContent["sub_appid"] = req.BizContent.AppId // 公众号或小程序 appid
+	}
+	return srv.request(ctx, request, req, res)
 }
 
+// WxFacePayInfo 获取微信刷脸调用凭证 刷脸后使用 face_code 通过 AopF2F(Method:wxface) 下单
 func (srv *Trade) WxFacePayInfo(ctx context.Context, req *pb.Request, res *pb.Response) (err error) {
-	return fmt.Errorf("暂不支持,微信刷脸:vipspt")
+	if v, ok := req.Config["RawData"]; !ok || v == "" {
+		return fmt.Errorf("vipspt RawData is empty")
+	}
+	request := requests.NewCommonRequest()
+	request.ApiName = "pay.facepayInfo"
+	request.BizContent = map[string]interface{}{
+		"merchant_id":   req.Config["SubMerId"],
+		"enterpriseReg": req.Config["EnterpriseReg"],
+		"store_id":      req.Config["StoreId"],   // 门店编号
+		"store_name":    req.Config["StoreName"], // 门店名称
+		"device_id":     req.Config["DeviceId"],  // 终端设备编号
+		"rawdata":       req.Config["RawData"],   // 刷脸 SDK 初始化数据
+		"sub_appid":     req.BizContent.AppId,
+		"now":           time.Now().Unix(),
+	}
+	return srv.request(ctx, request, req, res)
+}
+
+// BreakerStatus 网关熔断状态 Content 为各网关接口的熔断状态列表
+func (srv *Trade) BreakerStatus(ctx context.Context, req *pb.Request, res *pb.Response) (err error) {
+	breakers := srv.Breakers
+	if breakers == nil {
+		breakers = breaker.Default
+	}
+	r, err := json.Marshal(breakers.Status())
+	if err != nil {
+		return err
+	}
+	res.Content = string(r)
+	return nil
+}
+
+// newGateway 网关环境配置 pins 以逗号分隔
+func newGateway(baseUrl, caBundle, pins string) config.Gateway {
+	gateway := config.Gateway{
+		BaseUrl:  baseUrl,
+		CaBundle: caBundle,
+	}
+	for _, pin := range strings.Split(pins, ",") {
+		if pin = strings.TrimSpace(pin); pin != "" {
+			gateway.Pins = append(gateway.Pins, pin)
+		}
+	}
+	return gateway
+}
+
+// parseLimits 解析按接口限流配置 queue_timeout 为 time.Duration 格式
+func parseLimits(v string) (map[string]config.Limit, error) {
+	raw := map[string]struct {
+		Rate          float64 `json:"rate"`
+		Burst         int     `json:"burst"`
+		MaxConcurrent int     `json:"max_concurrent"`
+		QueueTimeout  string  `json:"queue_timeout"`
+	}{}
+	if err := json.Unmarshal([]byte(v), &raw); err != nil {
+		return nil, fmt.Errorf("vipspt Limits 格式错误: %v", err)
+	}
+	limits := map[string]config.Limit{}
+	for apiName, l := range raw {
+		limit := config.Limit{
+			Rate:          l.Rate,
+			Burst:         l.Burst,
+			MaxConcurrent: l.MaxConcurrent,
+		}
+		if l.QueueTimeout != "" {
+			d, err := time.ParseDuration(l.QueueTimeout)
+			if err != nil {
+				return nil, err
+			}
+			limit.QueueTimeout = d
+		}
+		limits[apiName] = limit
+	}
+	return limits, nil
+}
+
+// notifyUrl 异步通知地址 优先使用商户配置
+func (srv *Trade) notifyUrl(req *pb.Request) string {
+	if v, ok := req.Config["NotifyUrl"]; ok && v != "" {
+		return v
+	}
+	return srv.NotifyUrl
+}
+
+// requestId 从 go-micro metadata 获取请求 ID
+func requestId(ctx context.Context) string {
+	md, ok := metadata.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	for k, v := range md {
+		switch strings.ToLower(k) {
+		case "x-request-id", "micro-id":
+			return v
+		}
+	}
+	return ""
+}
+
+// platformLocation 平台交易时间时区
+var platformLocation = func() *time.Location {
+	if loc, err := time.LoadLocation("Asia/Shanghai"); err == nil {
+		return loc
+	}
+	return time.FixedZone("CST", 8*3600)
+}()
+
+// notifyTime 通知时间 优先使用 timeStamp(毫秒) 其次交易时间 dctime(北京时间)
+func notifyTime(post mxj.Map) (time.Time, error) {
+	if v, err := strconv.ParseInt(util.InterfaceToString(post["timeStamp"]), 10, 64); err == nil {
+		return time.Unix(0, v*int64(time.Millisecond)), nil
+	}
+	if v, ok := post["dctime"].(string); ok {
+		if t, err := time.ParseInLocation("2006-01-02 15:04:05", strings.Split(v, ".")[0], platformLocation); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("vipspt notify time is missing or invalid: timeStamp=%v dctime=%v", post["timeStamp"], post["dctime"])
 }
 
 // handlerRequest 处理请求
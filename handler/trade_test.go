@@ -0,0 +1,335 @@
+package handler
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/clbanning/mxj"
+	pb "github.com/lecex/pay/proto/tradeService"
+
+	"github.com/lecex/vipspt/service"
+	"github.com/lecex/vipspt/service/breaker"
+	"github.com/lecex/vipspt/service/config"
+	"github.com/lecex/vipspt/service/replay"
+	"github.com/lecex/vipspt/service/responses"
+	"github.com/lecex/vipspt/service/util"
+)
+
+// platformKey 测试平台密钥 platformPublicKey 为 PEM 公钥
+var platformKey, platformPublicKey = func() (*rsa.PrivateKey, string) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		panic(err)
+	}
+	der, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	return key, string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}()
+
+// platformSign 返回平台私钥签名后的数据副本
+func platformSign(t *testing.T, fields map[string]interface{}) map[string]interface{} {
+	data := map[string]interface{}{}
+	for k, v := range fields {
+		data[k] = v
+	}
+	sum := sha1.Sum([]byte(util.EncodeSignParams(data)))
+	sign, err := rsa.SignPKCS1v15(rand.Reader, platformKey, crypto.SHA1, sum[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	data["sSignature"] = base64.StdEncoding.EncodeToString(sign)
+	return data
+}
+
+// platformBody 返回平台私钥签名后的成功响应
+func platformBody(t *testing.T, fields map[string]interface{}) string {
+	body, _ := json.Marshal(map[string]interface{}{"ret": 0, "msg": "ok", "data": platformSign(t, fields)})
+	return string(body)
+}
+
+// fakeDoer 依次返回 bodies 记录请求接口 errs 按接口返回错误
+type fakeDoer struct {
+	apis   []string
+	bodies []string
+	errs   map[string]error
+}
+
+func (d *fakeDoer) Do(req *http.Request) (*http.Response, error) {
+	api := path.Base(req.URL.Path)
+	d.apis = append(d.apis, api)
+	if err := d.errs[api]; err != nil {
+		return nil, err
+	}
+	if len(d.bodies) == 0 {
+		return nil, errors.New("unexpected request " + api)
+	}
+	body := d.bodies[0]
+	d.bodies = d.bodies[1:]
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       ioutil.NopCloser(strings.NewReader(body)),
+		Header:     http.Header{},
+	}, nil
+}
+
+// newTestTrade 使用测试平台公钥及独立熔断的 Trade
+func newTestTrade(doer *fakeDoer) *Trade {
+	return &Trade{
+		PublicKey:  platformPublicKey,
+		Breakers:   breaker.NewRegistry(breaker.Options{}),
+		HTTPClient: doer,
+	}
+}
+
+// fastWaitPay 缩短轮询间隔 返回恢复函数
+func fastWaitPay() func() {
+	interval, maxInterval := waitPayInterval, waitPayMaxInterval
+	waitPayInterval, waitPayMaxInterval = 10*time.Millisecond, 20*time.Millisecond
+	return func() {
+		waitPayInterval, waitPayMaxInterval = interval, maxInterval
+	}
+}
+
+// testConfig 商户配置
+func testConfig() map[string]string {
+	return map[string]string{
+		"Appid":         "appid",
+		"SecretKey":     "secret",
+		"SubMerId":      "307989950941205",
+		"EnterpriseReg": "NKOt4Ygx",
+		"Sandbox":       "false",
+	}
+}
+
+func TestNewClientGateway(t *testing.T) {
+	srv := &Trade{
+		PublicKey:  "public",
+		Production: newGateway("https://gateway.example.com", "ca", " pin1, ,pin2"),
+		Sandbox:    config.Gateway{BaseUrl: "https://sandbox.example.com"},
+		Strict:     true,
+	}
+	conf := testConfig()
+	// 请求传入的网关配置不生效
+	conf["BaseUrl"] = "http://attacker.example.com"
+	conf["CaBundle"] = "attacker"
+	conf["Pins"] = "attacker"
+	conf["Strict"] = "false"
+	client, err := srv.NewClient(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := client.Config
+	if c.BaseUrl != "https://gateway.example.com" || c.CaBundle != "ca" || !reflect.DeepEqual(c.Pins, []string{"pin1", "pin2"}) || !c.Strict {
+		t.Errorf("production config = %+v", c)
+	}
+
+	conf["Sandbox"] = "true"
+	client, err = srv.NewClient(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := client.Config; c.BaseUrl != "https://sandbox.example.com" || c.CaBundle != "" || c.Pins != nil {
+		t.Errorf("sandbox config = %+v", c)
+	}
+}
+
+// order 订单返回数据 status 为平台订单状态
+func order(status string) map[string]interface{} {
+	return map[string]interface{}{"out_order_id": "1001", "third_order_id": "2001", "amount": "0.01", "status": status}
+}
+
+func TestAopF2FWaitPaySuccess(t *testing.T) {
+	defer fastWaitPay()()
+	doer := &fakeDoer{bodies: []string{
+		platformBody(t, order("0")),
+		platformBody(t, order("0")),
+		platformBody(t, order("0")),
+		platformBody(t, order("2")),
+	}}
+	conf := testConfig()
+	conf["WaitPayTimeout"] = "5"
+	req := &pb.Request{Config: conf, BizContent: &pb.BizContent{OutTradeNo: "1001", TotalFee: "1", AuthCode: "134567890123456789"}}
+	res := &pb.Response{}
+	if err := newTestTrade(doer).AopF2F(context.Background(), req, res); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"bToC", "query.do", "query.do", "query.do"}; !reflect.DeepEqual(doer.apis, want) {
+		t.Errorf("apis = %v, want %v", doer.apis, want)
+	}
+	data, err := mxj.NewMapJson([]byte(res.Content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data["status"] != responses.SUCCESS {
+		t.Errorf("status = %v, want SUCCESS", data["status"])
+	}
+}
+
+func TestWaitPayReverse(t *testing.T) {
+	defer fastWaitPay()()
+	// 等待 25ms 首次查询后下次查询超过等待时间 即撤销订单
+	paying := mxj.Map{"status": responses.USERPAYING}
+	reversed := map[string]interface{}{"out_order_id": "1001", "third_order_id": "2001", "status": "8"}
+	recall := map[string]interface{}{"out_order_id": "1001", "third_order_id": "2001", "status": "8", "recall": "Y"}
+	tests := []struct {
+		name    string
+		bodies  []string
+		errs    map[string]error
+		apis    []string
+		status  interface{}
+		unknown bool
+	}{
+		{
+			name:   "reverse on timeout",
+			bodies: []string{platformBody(t, order("0")), platformBody(t, reversed)},
+			apis:   []string{"query.do", "reverse.do"},
+			status: responses.CLOSED,
+		},
+		{
+			name:    "reverse error",
+			bodies:  []string{platformBody(t, order("0"))},
+			errs:    map[string]error{"reverse.do": errors.New("connection reset")},
+			apis:    []string{"query.do", "reverse.do"},
+			status:  responses.USERPAYING,
+			unknown: true,
+		},
+		{
+			name:    "reverse failed",
+			bodies:  []string{platformBody(t, order("0")), `{"ret":1,"msg":"撤销失败"}`},
+			apis:    []string{"query.do", "reverse.do"},
+			status:  responses.USERPAYING,
+			unknown: true,
+		},
+		{
+			name:   "recall then reversed",
+			bodies: []string{platformBody(t, order("0")), platformBody(t, recall), platformBody(t, reversed)},
+			apis:   []string{"query.do", "reverse.do", "reverse.do"},
+			status: responses.CLOSED,
+		},
+		{
+			name:    "recall exhausted",
+			bodies:  []string{platformBody(t, order("0")), platformBody(t, recall), platformBody(t, recall), platformBody(t, recall)},
+			apis:    []string{"query.do", "reverse.do", "reverse.do", "reverse.do"},
+			status:  responses.USERPAYING,
+			unknown: true,
+		},
+	}
+	for _, tt := range tests {
+		doer := &fakeDoer{bodies: tt.bodies, errs: tt.errs}
+		req := &pb.Request{Config: testConfig(), BizContent: &pb.BizContent{OutTradeNo: "1001"}}
+		data, err := newTestTrade(doer).waitPay(context.Background(), req, paying, 25*time.Millisecond)
+		if tt.unknown != errors.Is(err, service.ErrUnknownOutcome) {
+			t.Errorf("%s: err = %v, unknown outcome %v", tt.name, err, tt.unknown)
+		}
+		if !tt.unknown && err != nil {
+			t.Errorf("%s: err = %v", tt.name, err)
+		}
+		if !reflect.DeepEqual(doer.apis, tt.apis) {
+			t.Errorf("%s: apis = %v, want %v", tt.name, doer.apis, tt.apis)
+		}
+		if data["status"] != tt.status {
+			t.Errorf("%s: status = %v, want %v", tt.name, data["status"], tt.status)
+		}
+	}
+}
+
+func TestNewClientKeyOverlap(t *testing.T) {
+	srv := &Trade{PublicKey: "public"}
+	conf := testConfig()
+	conf["PublicKey"] = "new"
+	conf["PublicKeySecondary"] = "old"
+	if _, err := srv.NewClient(conf); err == nil || !strings.Contains(err.Error(), "KeyOverlapUntil") {
+		t.Errorf("secondary key without cutoff: err = %v", err)
+	}
+	conf["KeyOverlapUntil"] = "2026-01-01T00:00:00Z"
+	client, err := srv.NewClient(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC); !client.Config.KeyOverlapUntil.Equal(want) {
+		t.Errorf("KeyOverlapUntil = %v, want %v", client.Config.KeyOverlapUntil, want)
+	}
+}
+
+func TestAopF2FFaceCode(t *testing.T) {
+	for _, code := range []string{"", "  "} {
+		doer := &fakeDoer{}
+		req := &pb.Request{Config: testConfig(), BizContent: &pb.BizContent{Method: "wxface", OutTradeNo: "1001", TotalFee: "1", AuthCode: code}}
+		err := newTestTrade(doer).AopF2F(context.Background(), req, &pb.Response{})
+		if err == nil || !strings.Contains(err.Error(), "face_code") {
+			t.Errorf("face_code %q: err = %v", code, err)
+		}
+		if len(doer.apis) != 0 {
+			t.Errorf("face_code %q: apis = %v, want none", code, doer.apis)
+		}
+	}
+	doer := &fakeDoer{bodies: []string{platformBody(t, order("2"))}}
+	req := &pb.Request{Config: testConfig(), BizContent: &pb.BizContent{Method: "wxface", OutTradeNo: "1001", TotalFee: "1", AuthCode: "face-code"}}
+	if err := newTestTrade(doer).AopF2F(context.Background(), req, &pb.Response{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNotifyTime(t *testing.T) {
+	want := time.Date(2022, 10, 11, 3, 13, 51, 0, time.UTC)
+	tests := []struct {
+		name string
+		post mxj.Map
+		ok   bool
+	}{
+		{"timeStamp", mxj.Map{"timeStamp": "1665458031000", "dctime": "2000-01-01 00:00:00"}, true},
+		{"dctime beijing time", mxj.Map{"dctime": "2022-10-11 11:13:51"}, true},
+		{"dctime fraction", mxj.Map{"dctime": "2022-10-11 11:13:51.0"}, true},
+		{"missing", mxj.Map{"out_order_id": "1001"}, false},
+		{"invalid", mxj.Map{"timeStamp": "now", "dctime": "2022/10/11"}, false},
+	}
+	for _, tt := range tests {
+		got, err := notifyTime(tt.post)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: err = %v, want ok %v", tt.name, err, tt.ok)
+			continue
+		}
+		if tt.ok && !got.Equal(want) {
+			t.Errorf("%s: time = %v, want %v", tt.name, got, want)
+		}
+	}
+}
+
+func TestNotifyRejectsMissingTime(t *testing.T) {
+	srv := newTestTrade(&fakeDoer{})
+	srv.Replay = replay.NewGuard(replay.NewMemoryStore(100), time.Hour)
+	notify := func(fields map[string]interface{}) string {
+		post := map[string]*pb.Pair{}
+		for k, v := range platformSign(t, fields) {
+			post[k] = &pb.Pair{Key: k, Values: v.(string)}
+		}
+		req := &pb.NotifyRequest{Get: map[string]*pb.Pair{"id": {Key: "id", Values: "1"}}, Post: post}
+		res := &pb.NotifyResponse{}
+		if err := srv.Notify(context.Background(), req, res); err != nil {
+			t.Fatal(err)
+		}
+		return res.Body
+	}
+	// 验签通过后由防重放校验时间窗口
+	if body := notify(map[string]interface{}{"out_order_id": "1001", "status": "2", "nonce": "n1", "timeStamp": "1000"}); body != "FAIL" || srv.Replay.Rejected() != 1 {
+		t.Fatalf("expired: body = %s, rejected = %d", body, srv.Replay.Rejected())
+	}
+	// 无通知时间时在防重放校验前拒绝
+	if body := notify(map[string]interface{}{"out_order_id": "1001", "status": "2", "nonce": "n2"}); body != "FAIL" || srv.Replay.Rejected() != 1 {
+		t.Errorf("missing time: body = %s, rejected = %d", body, srv.Replay.Rejected())
+	}
+}
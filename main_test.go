@@ -13,6 +13,7 @@ import (
 var Config = map[string]string{
 	"Appid":         os.Getenv("PAY_VIPSPT_APPID"),
 	"SecretKey":     os.Getenv("PAY_VIPSPT_SECRET_KEY"),
+	"PublicKey":     os.Getenv("PAY_VIPSPT_PUBLIC_KEY"),
 	"SubMerId":      os.Getenv("PAY_VIPSPT_MERCHANT_IDD"),
 	"EnterpriseReg": os.Getenv("PAY_VIPSPT_ENTERPRISE_REG"),
 	"Sandbox":       fmt.Sprintf("%t", false),
@@ -0,0 +1,224 @@
+package breaker
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/lecex/vipspt/service/logger"
+)
+
+// ErrChannelUnavailable 支付通道不可用 熔断打开时直接返回
+var ErrChannelUnavailable = errors.New("vipspt channel unavailable")
+
+// UnavailableError 熔断打开 errors.Is(err, ErrChannelUnavailable) 为 true
+type UnavailableError struct {
+	Key        string
+	RetryAfter time.Duration // 距离半开探测的剩余时间
+}
+
+func (e *UnavailableError) Error() string {
+	return fmt.Sprintf("%v: %s retry after %s", ErrChannelUnavailable, e.Key, e.RetryAfter)
+}
+
+// Is 匹配 ErrChannelUnavailable
+func (e *UnavailableError) Is(target error) bool {
+	return target == ErrChannelUnavailable
+}
+
+// State 熔断状态
+type State int
+
+const (
+	Closed   State = iota // 正常
+	Open                  // 熔断 拒绝请求
+	HalfOpen              // 半开 允许探测请求
+)
+
+func (s State) String() string {
+	switch s {
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	}
+	return "closed"
+}
+
+// Options 熔断配置 零值使用默认值
+type Options struct {
+	FailureThreshold int           // 连续失败次数达到后熔断 默认 5
+	OpenTimeout      time.Duration // 熔断持续时间 之后进入半开 默认 30s
+	HalfOpenProbes   int           // 半开时允许的并发探测请求 默认 1
+	MinTimeout       time.Duration // 计入失败的最短超时 更短的超时视为商户配置导致 默认 5s
+}
+
+func (o Options) withDefaults() Options {
+	if o.FailureThreshold <= 0 {
+		o.FailureThreshold = 5
+	}
+	if o.OpenTimeout <= 0 {
+		o.OpenTimeout = 30 * time.Second
+	}
+	if o.HalfOpenProbes <= 0 {
+		o.HalfOpenProbes = 1
+	}
+	if o.MinTimeout <= 0 {
+		o.MinTimeout = 5 * time.Second
+	}
+	return o
+}
+
+// Breaker 熔断器
+type Breaker struct {
+	mu       sync.Mutex
+	key      string
+	opts     Options
+	state    State
+	failures int       // 连续失败次数
+	probes   int       // 进行中的探测请求
+	changed  time.Time // 最近状态变更时间
+}
+
+// New 创建熔断器 配置在创建时确定
+func New(key string, opts Options) *Breaker {
+	return &Breaker{
+		key:     key,
+		opts:    opts.withDefaults(),
+		changed: time.Now(),
+	}
+}
+
+// Options 熔断配置
+func (b *Breaker) Options() Options {
+	return b.opts
+}
+
+// Allow 是否允许请求 允许后必须调用 Report 或 Release requestId 用于状态变更日志
+func (b *Breaker) Allow(requestId string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == Open {
+		if wait := b.opts.OpenTimeout - time.Since(b.changed); wait > 0 {
+			return &UnavailableError{Key: b.key, RetryAfter: wait}
+		}
+		b.setState(requestId, HalfOpen)
+	}
+	if b.state == HalfOpen {
+		if b.probes >= b.opts.HalfOpenProbes {
+			return &UnavailableError{Key: b.key}
+		}
+		b.probes++
+	}
+	return nil
+}
+
+// Report 记录请求结果 半开时探测成功关闭熔断 失败重新熔断
+func (b *Breaker) Report(requestId string, success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == HalfOpen && b.probes > 0 {
+		b.probes--
+	}
+	if success {
+		b.failures = 0
+		if b.state == HalfOpen {
+			b.setState(requestId, Closed)
+		}
+		return
+	}
+	b.failures++
+	if b.state == HalfOpen || (b.state == Closed && b.failures >= b.opts.FailureThreshold) {
+		b.setState(requestId, Open)
+	}
+}
+
+// Release 放弃请求结果 如调用方取消
+func (b *Breaker) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == HalfOpen && b.probes > 0 {
+		b.probes--
+	}
+}
+
+// setState 变更状态并记录触发请求的日志 调用方持有锁
+func (b *Breaker) setState(requestId string, state State) {
+	logger.Default.Warn(requestId, "Vipspt[breaker]", logger.Fields{
+		"key":      b.key,
+		"from":     b.state.String(),
+		"to":       state.String(),
+		"failures": b.failures,
+	})
+	b.state = state
+	b.probes = 0
+	b.changed = time.Now()
+}
+
+// Status 熔断状态
+type Status struct {
+	Key      string    `json:"key"`
+	State    string    `json:"state"`
+	Failures int       `json:"failures"`
+	Changed  time.Time `json:"changed"`
+}
+
+// Status 当前状态
+func (b *Breaker) Status() Status {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return Status{
+		Key:      b.key,
+		State:    b.state.String(),
+		Failures: b.failures,
+		Changed:  b.changed,
+	}
+}
+
+// Registry 按 key 管理熔断器 所有熔断器使用相同配置
+type Registry struct {
+	mu       sync.Mutex
+	opts     Options
+	breakers map[string]*Breaker
+}
+
+// Default 默认熔断器 使用默认配置
+var Default = NewRegistry(Options{})
+
+// NewRegistry 创建熔断器管理 配置由服务运维设置
+func NewRegistry(opts Options) *Registry {
+	return &Registry{
+		opts:     opts,
+		breakers: map[string]*Breaker{},
+	}
+}
+
+// Get 获取熔断器 不存在时创建
+func (r *Registry) Get(key string) *Breaker {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	b, ok := r.breakers[key]
+	if !ok {
+		b = New(key, r.opts)
+		r.breakers[key] = b
+	}
+	return b
+}
+
+// Status 所有熔断器状态 按 key 排序
+func (r *Registry) Status() []Status {
+	r.mu.Lock()
+	breakers := make([]*Breaker, 0, len(r.breakers))
+	for _, b := range r.breakers {
+		breakers = append(breakers, b)
+	}
+	r.mu.Unlock()
+	list := make([]Status, 0, len(breakers))
+	for _, b := range breakers {
+		list = append(list, b.Status())
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Key < list[j].Key })
+	return list
+}
@@ -0,0 +1,67 @@
+package breaker
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	b := New("test", Options{FailureThreshold: 2, OpenTimeout: 10 * time.Millisecond})
+	for i := 0; i < 2; i++ {
+		if err := b.Allow("test"); err != nil {
+			t.Fatalf("closed Allow: %v", err)
+		}
+		b.Report("test", false)
+	}
+	if got := b.Status().State; got != "open" {
+		t.Fatalf("state = %s, want open", got)
+	}
+	if err := b.Allow("test"); !errors.Is(err, ErrChannelUnavailable) {
+		t.Fatalf("open Allow = %v, want ErrChannelUnavailable", err)
+	}
+
+	time.Sleep(15 * time.Millisecond)
+	if err := b.Allow("test"); err != nil {
+		t.Fatalf("half-open probe: %v", err)
+	}
+	if err := b.Allow("test"); !errors.Is(err, ErrChannelUnavailable) {
+		t.Fatalf("second probe = %v, want ErrChannelUnavailable", err)
+	}
+	b.Report("test", false)
+	if got := b.Status().State; got != "open" {
+		t.Fatalf("failed probe state = %s, want open", got)
+	}
+
+	time.Sleep(15 * time.Millisecond)
+	if err := b.Allow("test"); err != nil {
+		t.Fatalf("half-open probe: %v", err)
+	}
+	b.Report("test", true)
+	if got := b.Status(); got.State != "closed" || got.Failures != 0 {
+		t.Fatalf("status = %+v, want closed", got)
+	}
+}
+
+func TestRegistryOptions(t *testing.T) {
+	r := NewRegistry(Options{FailureThreshold: 1, OpenTimeout: time.Minute})
+	b := r.Get("test")
+	if got := r.Get("test"); got != b {
+		t.Fatal("Get returned another breaker")
+	}
+	if got := b.Options(); got.FailureThreshold != 1 || got.HalfOpenProbes != 1 || got.MinTimeout != 5*time.Second {
+		t.Errorf("options = %+v", got)
+	}
+	b.Allow("test")
+	b.Report("test", false)
+	if err := r.Get("test").Allow("test"); !errors.Is(err, ErrChannelUnavailable) {
+		t.Fatalf("Allow = %v, want ErrChannelUnavailable", err)
+	}
+	// 其他 key 使用相同配置 互不影响
+	if err := r.Get("other").Allow("test"); err != nil {
+		t.Fatalf("other Allow = %v", err)
+	}
+	if got := len(r.Status()); got != 2 {
+		t.Errorf("status = %d, want 2", got)
+	}
+}
@@ -1,15 +1,25 @@
 package service
 
 import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/lecex/vipspt/service/breaker"
 	"github.com/lecex/vipspt/service/common"
 	"github.com/lecex/vipspt/service/config"
+	"github.com/lecex/vipspt/service/limiter"
 	"github.com/lecex/vipspt/service/requests"
 	"github.com/lecex/vipspt/service/responses"
+	"github.com/lecex/vipspt/service/util"
 )
 
 // Client the type Client
 type Client struct {
-	Config *config.Config
+	Config     *config.Config
+	HTTPClient util.Doer         // 为空时按配置使用共享连接池
+	Breakers   *breaker.Registry // 为空时使用 breaker.Default
+	Limiters   *limiter.Registry // 为空时使用 limiter.Default
 }
 
 // NewClient 创建默认连接
@@ -21,22 +31,102 @@ func NewClient() (client *Client) {
 }
 
 // ProcessCommonRequest 处理公共请求
-func (client *Client) ProcessCommonRequest(request *requests.CommonRequest) (response *responses.CommonResponse, err error) {
+func (client *Client) ProcessCommonRequest(ctx context.Context, request *requests.CommonRequest) (response *responses.CommonResponse, err error) {
 	response = responses.NewCommonResponse(client.Config, request)
-	err = client.DoAction(request, response)
+	err = client.DoAction(ctx, request, response)
 	return
 }
 
-// DoAction 执行动作
-func (client *Client) DoAction(request *requests.CommonRequest, response *responses.CommonResponse) (err error) {
+// 分页请求上限 超出时返回错误 需缩小查询范围
+const (
+	maxPages    = 100  // 最多请求页数
+	maxPageSize = 1000 // 每页最多记录数
+)
+
+// ProcessPageRequest 处理分页请求 按 totalPage 自动请求所有页并合并 list
+// 总页数超过 maxPages 或单页记录超过 maxPageSize 时返回错误
+func (client *Client) ProcessPageRequest(ctx context.Context, request *requests.CommonRequest) (list []interface{}, err error) {
+	list = []interface{}{}
+	for page := 1; ; page++ {
+		request.BizContent["page"] = page
+		response, err := client.ProcessCommonRequest(ctx, request)
+		if err != nil {
+			return nil, err
+		}
+		data, err := response.GetVerifySignDataMap()
+		if err != nil {
+			return nil, err
+		}
+		if data["return_code"] != responses.SUCCESS {
+			return nil, fmt.Errorf("vipspt %s page %d: %v", request.ApiName, page, data["return_msg"])
+		}
+		if v, ok := data["list"].([]interface{}); ok {
+			if len(v) > maxPageSize {
+				return nil, fmt.Errorf("vipspt %s page %d: %d records exceeds limit %d", request.ApiName, page, len(v), maxPageSize)
+			}
+			list = append(list, v...)
+		}
+		totalPage, _ := strconv.Atoi(util.InterfaceToString(data["total_page"]))
+		if totalPage > maxPages {
+			return nil, fmt.Errorf("vipspt %s total page %d exceeds limit %d, narrow the query range", request.ApiName, totalPage, maxPages)
+		}
+		if page >= totalPage {
+			return list, nil
+		}
+	}
+}
+
+// DoAction 执行动作 网关请求失败时按接口幂等性重试或查询确认结果
+func (client *Client) DoAction(ctx context.Context, request *requests.CommonRequest, response *responses.CommonResponse) (err error) {
+	if _, ok := resolveApis[request.ApiName]; ok {
+		return client.doResolve(ctx, request, response)
+	}
+	if idempotentApis[request.ApiName] {
+		return client.doRetry(ctx, request, response)
+	}
+	return client.do(ctx, request, response)
+}
+
+// do 执行单次请求
+func (client *Client) do(ctx context.Context, request *requests.CommonRequest, response *responses.CommonResponse) (err error) {
+	doer, err := client.doer()
+	if err != nil {
+		return err
+	}
 	// 创建访问链接
 	u := &common.Common{
 		Config:   client.Config,
 		Requests: request,
+		Doer:     doer,
+		Breakers: client.Breakers,
+		Limiters: client.Limiters,
 	}
-	err = u.Action(response)
+	err = u.Action(ctx, response)
 	if err != nil {
 		return err
 	}
 	return
 }
+
+// doer 获取 HTTP 连接 相同环境配置共享连接池
+func (client *Client) doer() (util.Doer, error) {
+	if client.HTTPClient != nil {
+		return client.HTTPClient, nil
+	}
+	con := client.Config
+	return util.HTTPClient(util.HTTPOptions{
+		CaBundle:            con.CaBundle,
+		Pins:                con.Pins,
+		Cert:                con.Cert,
+		CertKey:             con.CertKey,
+		CertPassword:        con.CertPassword,
+		CertDir:             con.CertDir,
+		ConnectTimeout:      con.Transport.ConnectTimeout,
+		ReadTimeout:         con.Transport.ReadTimeout,
+		Timeout:             con.Transport.Timeout,
+		MaxIdleConns:        con.Transport.MaxIdleConns,
+		MaxIdleConnsPerHost: con.Transport.MaxIdleConnsPerHost,
+		Proxy:               con.Transport.Proxy,
+		KeepAlive:           con.Transport.KeepAlive,
+	})
+}
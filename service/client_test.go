@@ -0,0 +1,326 @@
+package service
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/lecex/vipspt/service/breaker"
+	"github.com/lecex/vipspt/service/common"
+	"github.com/lecex/vipspt/service/limiter"
+	"github.com/lecex/vipspt/service/requests"
+	"github.com/lecex/vipspt/service/responses"
+	"github.com/lecex/vipspt/service/util"
+)
+
+// fakeDoer 记录请求并返回固定响应 errs 依次作为前几次请求的错误 bodies 依次作为响应
+type fakeDoer struct {
+	requests []*http.Request
+	body     string
+	bodies   []string
+	errs     []error
+}
+
+func (d *fakeDoer) Do(req *http.Request) (*http.Response, error) {
+	d.requests = append(d.requests, req)
+	if len(d.errs) > 0 {
+		err := d.errs[0]
+		d.errs = d.errs[1:]
+		return nil, err
+	}
+	body := d.body
+	if len(d.bodies) > 0 {
+		body = d.bodies[0]
+		d.bodies = d.bodies[1:]
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       ioutil.NopCloser(strings.NewReader(body)),
+		Header:     http.Header{},
+	}, nil
+}
+
+func TestDoActionUsesInjectedDoer(t *testing.T) {
+	doer := &fakeDoer{body: `{"ret":"0","msg":"ok"}`}
+	client := newTestClient(doer)
+	client.Config.Appid = "appid"
+	client.Config.SecretKey = "secret"
+	client.Config.BaseUrl = "https://gateway.example.com/"
+
+	request := requests.NewCommonRequest()
+	request.ApiName = "pay.query"
+	request.BizContent = map[string]interface{}{"out_order_id": "1"}
+	response, err := client.ProcessCommonRequest(context.Background(), request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(doer.requests) != 1 {
+		t.Fatalf("requests = %d, want 1", len(doer.requests))
+	}
+	if got := doer.requests[0].URL.String(); got != "https://gateway.example.com/payOpen/query.do" {
+		t.Errorf("url = %s", got)
+	}
+	body, _ := ioutil.ReadAll(doer.requests[0].Body)
+	params := map[string]interface{}{}
+	if err := json.Unmarshal(body, &params); err != nil {
+		t.Fatal(err)
+	}
+	if params["appid"] != "appid" || params["sign"] == "" {
+		t.Errorf("params = %v", params)
+	}
+	if response.GetHttpContentJson() != doer.body {
+		t.Errorf("content = %s", response.GetHttpContentJson())
+	}
+}
+
+// newTestClient 重试等待缩短为 1ms 使用独立的熔断及限流 避免测试间互相影响
+func newTestClient(doer *fakeDoer) *Client {
+	client := NewClient()
+	client.HTTPClient = doer
+	client.Breakers = breaker.NewRegistry(breaker.Options{})
+	client.Limiters = limiter.NewRegistry()
+	client.Config.BaseUrl = "https://gateway.example.com"
+	client.Config.Retry.BaseDelay = time.Millisecond
+	client.Config.Retry.MaxDelay = time.Millisecond
+	return client
+}
+
+func TestDoActionRetriesQuery(t *testing.T) {
+	doer := &fakeDoer{
+		body: `{"ret":"0","msg":"ok"}`,
+		errs: []error{errors.New("timeout"), errors.New("timeout")},
+	}
+	request := requests.NewCommonRequest()
+	request.ApiName = "pay.query"
+	request.BizContent = map[string]interface{}{"out_order_id": "1"}
+	if _, err := newTestClient(doer).ProcessCommonRequest(context.Background(), request); err != nil {
+		t.Fatal(err)
+	}
+	if len(doer.requests) != 3 {
+		t.Errorf("requests = %d, want 3", len(doer.requests))
+	}
+
+	doer = &fakeDoer{errs: []error{errors.New("timeout"), errors.New("timeout"), errors.New("timeout")}}
+	_, err := newTestClient(doer).ProcessCommonRequest(context.Background(), request)
+	var netErr *common.NetworkError
+	if !errors.As(err, &netErr) {
+		t.Errorf("err = %v, want NetworkError", err)
+	}
+}
+
+func TestDoActionResolvesPayByQuery(t *testing.T) {
+	doer := &fakeDoer{
+		body: `{"ret":"0","msg":"ok","data":{"out_order_id":"1","status":"2"}}`,
+		errs: []error{errors.New("timeout")},
+	}
+	request := requests.NewCommonRequest()
+	request.ApiName = "pay.pay"
+	request.BizContent = map[string]interface{}{"out_order_id": "1", "sAuthCode": "134567890123456789"}
+	response, err := newTestClient(doer).ProcessCommonRequest(context.Background(), request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(doer.requests) != 2 {
+		t.Fatalf("requests = %d, want 2", len(doer.requests))
+	}
+	if got := doer.requests[1].URL.Path; got != "/payOpen/query.do" {
+		t.Errorf("resolve path = %s, want query", got)
+	}
+	body, _ := ioutil.ReadAll(doer.requests[1].Body)
+	if strings.Contains(string(body), "sAuthCode") {
+		t.Errorf("resolve resent pay params: %s", body)
+	}
+	if response.GetHttpContentJson() != doer.body {
+		t.Errorf("content = %s", response.GetHttpContentJson())
+	}
+}
+
+func TestDoActionResolveOutcome(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		unknown bool
+	}{
+		{"busy", `{"ret":"1","msg":"系统繁忙"}`, true},
+		{"not exist", `{"ret":"1","msg":"订单不存在"}`, false},
+	}
+	for _, tt := range tests {
+		doer := &fakeDoer{body: tt.body, errs: []error{errors.New("timeout")}}
+		request := requests.NewCommonRequest()
+		request.ApiName = "pay.pay"
+		request.BizContent = map[string]interface{}{"out_order_id": "1"}
+		response, err := newTestClient(doer).ProcessCommonRequest(context.Background(), request)
+		if got := errors.Is(err, ErrUnknownOutcome); got != tt.unknown {
+			t.Errorf("%s: err = %v, want unknown %v", tt.name, err, tt.unknown)
+		}
+		if len(doer.requests) != 4 {
+			t.Errorf("%s: requests = %d, want pay and 3 queries", tt.name, len(doer.requests))
+		}
+		if !tt.unknown && response.GetHttpContentJson() != tt.body {
+			t.Errorf("%s: content = %s", tt.name, response.GetHttpContentJson())
+		}
+	}
+}
+
+func TestPinsRequireHttps(t *testing.T) {
+	doer := &fakeDoer{body: `{"ret":"0","msg":"ok"}`}
+	client := newTestClient(doer)
+	client.Config.BaseUrl = "http://gateway.example.com"
+	client.Config.Pins = []string{"AAAA"}
+	request := requests.NewCommonRequest()
+	request.ApiName = "pay.query"
+	request.BizContent = map[string]interface{}{"out_order_id": "1"}
+	if _, err := client.ProcessCommonRequest(context.Background(), request); err == nil {
+		t.Fatal("pins over http accepted")
+	}
+	if len(doer.requests) != 0 {
+		t.Errorf("requests = %d, want 0", len(doer.requests))
+	}
+}
+
+// platformKey 测试平台密钥 platformPublicKey 为 PEM 公钥
+var platformKey, platformPublicKey = func() (*rsa.PrivateKey, string) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		panic(err)
+	}
+	der, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	return key, string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}()
+
+// platformSign 按平台规则 RSA SHA1 签名
+func platformSign(t *testing.T, data map[string]interface{}) map[string]interface{} {
+	sum := sha1.Sum([]byte(util.EncodeSignParams(data)))
+	sign, err := rsa.SignPKCS1v15(rand.Reader, platformKey, crypto.SHA1, sum[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	data["sSignature"] = base64.StdEncoding.EncodeToString(sign)
+	return data
+}
+
+// listPage 返回签名后的 pay.list 分页响应
+func listPage(t *testing.T, totalPage int, records ...map[string]interface{}) string {
+	data := []interface{}{}
+	for _, record := range records {
+		data = append(data, platformSign(t, record))
+	}
+	body, _ := json.Marshal(map[string]interface{}{"ret": 0, "msg": "ok", "totalPage": totalPage, "data": data})
+	return string(body)
+}
+
+func newListRequest() *requests.CommonRequest {
+	request := requests.NewCommonRequest()
+	request.ApiName = "pay.list"
+	request.BizContent = map[string]interface{}{"start_date": "2022-10-11", "end_date": "2022-10-11"}
+	return request
+}
+
+func TestProcessPageRequest(t *testing.T) {
+	doer := &fakeDoer{bodies: []string{
+		listPage(t, 2, map[string]interface{}{
+			"out_order_id": "1", "third_order_id": "t1", "amount": "0.01", "status": "2",
+			"pay_way": "WXZF", "dctime": "2022-10-11 11:13:51.0",
+		}),
+		listPage(t, 2, map[string]interface{}{
+			"out_order_id": "2", "third_order_id": "t2", "old_third_order_id": "t1", "amount": "-0.01", "status": "2",
+		}),
+	}}
+	client := newTestClient(doer)
+	client.Config.PublicKey = platformPublicKey
+	list, err := client.ProcessPageRequest(context.Background(), newListRequest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(doer.requests) != 2 || len(list) != 2 {
+		t.Fatalf("requests = %d, list = %d, want 2", len(doer.requests), len(list))
+	}
+	for i, req := range doer.requests {
+		body, _ := ioutil.ReadAll(req.Body)
+		if !strings.Contains(string(body), fmt.Sprintf(`"page":%d`, i+1)) {
+			t.Errorf("request %d body = %s", i, body)
+		}
+	}
+	pay := list[0].(map[string]interface{})
+	if pay["status"] != responses.SUCCESS || pay["total_fee"] != int64(1) || pay["refund"] != false ||
+		pay["out_trade_no"] != "1" || pay["bank_trade_no"] != "t1" || pay["time_end"] != "20221011111351" {
+		t.Errorf("pay = %v", pay)
+	}
+	refund := list[1].(map[string]interface{})
+	if refund["total_fee"] != int64(-1) || refund["refund"] != true || refund["original_bank_trade_no"] != "t1" {
+		t.Errorf("refund = %v", refund)
+	}
+}
+
+func TestProcessPageRequestLimits(t *testing.T) {
+	records := make([]map[string]interface{}, maxPageSize+1)
+	for i := range records {
+		records[i] = map[string]interface{}{"out_order_id": "1", "amount": "0.01", "status": "2"}
+	}
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"too many pages", listPage(t, maxPages+1)},
+		{"page too large", listPage(t, 1, records...)},
+	}
+	for _, tt := range tests {
+		doer := &fakeDoer{body: tt.body}
+		client := newTestClient(doer)
+		client.Config.PublicKey = platformPublicKey
+		if _, err := client.ProcessPageRequest(context.Background(), newListRequest()); err == nil {
+			t.Errorf("%s: no error", tt.name)
+		}
+		if len(doer.requests) != 1 {
+			t.Errorf("%s: requests = %d, want 1", tt.name, len(doer.requests))
+		}
+	}
+}
+
+func TestBreakerCountsGatewayFailures(t *testing.T) {
+	request := requests.NewCommonRequest()
+	request.ApiName = "pay.query"
+	request.BizContent = map[string]interface{}{"out_order_id": "1"}
+	errs := func(err error) []error {
+		list := make([]error, 6)
+		for i := range list {
+			list[i] = err
+		}
+		return list
+	}
+
+	// 本地证书锁定失败不计入熔断
+	client := newTestClient(&fakeDoer{body: `{"ret":"0","msg":"ok"}`, errs: errs(util.ErrPinMismatch)})
+	for i := 0; i < 2; i++ {
+		client.ProcessCommonRequest(context.Background(), request)
+	}
+	for _, status := range client.Breakers.Status() {
+		if status.State != "closed" || status.Failures != 0 {
+			t.Errorf("local failures: status = %+v", status)
+		}
+	}
+
+	// 网关连接失败达到阈值后熔断
+	client = newTestClient(&fakeDoer{body: `{"ret":"0","msg":"ok"}`, errs: errs(&net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED})})
+	for i := 0; i < 2; i++ {
+		client.ProcessCommonRequest(context.Background(), request)
+	}
+	if _, err := client.ProcessCommonRequest(context.Background(), request); !errors.Is(err, breaker.ErrChannelUnavailable) {
+		t.Errorf("gateway failures: err = %v, want ErrChannelUnavailable", err)
+	}
+}
@@ -1,37 +1,74 @@
 package common
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"io"
+	"net"
+	"strings"
 	"time"
 
+	"github.com/lecex/vipspt/service/breaker"
 	"github.com/lecex/vipspt/service/config"
+	"github.com/lecex/vipspt/service/limiter"
+	"github.com/lecex/vipspt/service/logger"
 	"github.com/lecex/vipspt/service/requests"
 	"github.com/lecex/vipspt/service/responses"
 	"github.com/lecex/vipspt/service/util"
-	"github.com/micro/go-micro/v2/util/log"
 )
 
 var apiUrlsMch = map[string]string{
-	"pay.pay":         "/payOpen/bToC",      //付款码支付
-	"pay.query":       "/payOpen/query.do",  //统一查询接口
-	"pay.refund":      "/payOpen/refund.do", //统一退款接口
-	"pay.refundQuery": "/payOpen/query.do",  //统一退款查询接口
+	"pay.pay":         "/payOpen/bToC",             //付款码支付
+	"pay.query":       "/payOpen/query.do",         //统一查询接口
+	"pay.refund":      "/payOpen/refund.do",        //统一退款接口
+	"pay.refundQuery": "/payOpen/query.do",         //统一退款查询接口
+	"pay.jsapi":       "/payOpen/jsapi.do",         //公众号、小程序、服务窗支付
+	"pay.qrcode":      "/payOpen/cToB",             //动态二维码支付
+	"pay.close":       "/payOpen/close.do",         //关闭订单接口
+	"pay.reverse":     "/payOpen/reverse.do",       //撤销订单接口
+	"pay.openid":      "/payOpen/openid.do",        //付款码查询用户标识
+	"pay.facepayInfo": "/payOpen/wxFacePayInfo.do", //微信刷脸调用凭证
+	"pay.list":        "/payOpen/query.do",         //交易流水查询(分页)
+}
+
+// NetworkError 网关请求失败 请求可能已被网关处理 结果未知
+type NetworkError struct {
+	ApiName string
+	Err     error
+}
+
+func (e *NetworkError) Error() string {
+	return fmt.Sprintf("vipspt %s 网关请求失败: %v", e.ApiName, e.Err)
+}
+
+// Unwrap 原始错误
+func (e *NetworkError) Unwrap() error {
+	return e.Err
 }
 
 // Common 公共封装
 type Common struct {
 	Config   *config.Config
 	Requests *requests.CommonRequest
+	Doer     util.Doer
+	Breakers *breaker.Registry // 为空时使用 breaker.Default
+	Limiters *limiter.Registry // 为空时使用 limiter.Default
 }
 
 // Action 创建新的公共连接
-func (c *Common) Action(response *responses.CommonResponse) (err error) {
-	return c.Request(response)
+func (c *Common) Action(ctx context.Context, response *responses.CommonResponse) (err error) {
+	return c.Request(ctx, response)
 }
 
 // APIBaseURL 默认 API 网关
 func (c *Common) APIBaseURL() string {
 	con := c.Config
+	if con.BaseUrl != "" { // 自定义网关
+		return strings.TrimRight(con.BaseUrl, "/")
+	}
 	if con.Sandbox { // 沙盒模式
 		return "http://47.107.41.218:8093"
 	}
@@ -46,6 +83,14 @@ func (c *Common) ApiUrl() (apiUrl string, err error) {
 	} else {
 		err = fmt.Errorf("ApiName 不存在请检查。")
 	}
+	// 严格模式 生产环境必须使用 https
+	if err == nil && c.Config.Strict && !c.Config.Sandbox && !strings.HasPrefix(apiUrl, "https://") {
+		err = fmt.Errorf("vipspt 严格模式禁止生产环境使用 http: %s", apiUrl)
+	}
+	// 证书公钥锁定仅对 https 生效
+	if err == nil && len(c.Config.Pins) > 0 && !strings.HasPrefix(apiUrl, "https://") {
+		err = fmt.Errorf("vipspt 证书公钥锁定需使用 https: %s", apiUrl)
+	}
 	return
 }
 
@@ -61,14 +106,18 @@ func (c *Common) ApiUrl() (apiUrl string, err error) {
 // NotifyUrl    string `json:"notify_url"`     //工行开发平台服务器主动通知商户服务器里指定的页面http/https路径。
 // BizContent   string `json:"biz_content"`    //业务请求参数的集合，最大长度不限，除公共参数外所有请求参数都必须放在这个参数中传递，具体参照各产品快速接入文档
 // ReturnUrl    string `json:"return_url"`     //HTTP/HTTPS开头字符串
-func (c *Common) Request(response *responses.CommonResponse) (err error) {
+func (c *Common) Request(ctx context.Context, response *responses.CommonResponse) (err error) {
 	con := c.Config
 	req := c.Requests
 	apiUrl, err := c.ApiUrl()
 	if err != nil {
 		return err
 	}
-	sign, err := util.Sign(req.BizContent, con.SecretKey) // 开发签名
+	signer, err := util.NewSigner(con.SignType, con.SecretKey) // 按签名类型签名
+	if err != nil {
+		return err
+	}
+	sign, err := signer.Sign(req.BizContent)
 	if err != nil {
 		return err
 	}
@@ -80,12 +129,108 @@ func (c *Common) Request(response *responses.CommonResponse) (err error) {
 		"sign":      sign,
 		"data":      req.BizContent,
 	}
-	log.Info("Vipspt[PostJSON]", apiUrl, params)
-	res, err := util.PostJSON(apiUrl, params)
-	log.Info("Vipspt[PostJSON]res", string(res), err)
+	if req.RequestId == "" {
+		req.RequestId = logger.NewRequestId()
+	}
+	logger.Default.Info(req.RequestId, "Vipspt[PostJSON]", logger.Fields{
+		"api":    req.ApiName,
+		"url":    apiUrl,
+		"params": params,
+	})
+	// 按商户及接口限流 超限时排队或直接返回
+	limit := con.ApiLimit(req.ApiName)
+	limiters := c.Limiters
+	if limiters == nil {
+		limiters = limiter.Default
+	}
+	limitOpts := limiter.Options{
+		Rate:          limit.Rate,
+		Burst:         limit.Burst,
+		MaxConcurrent: limit.MaxConcurrent,
+		QueueTimeout:  limit.QueueTimeout,
+	}
+	lim, updated := limiters.Get(con.Appid+"/"+con.MerchantId+" "+req.ApiName, limitOpts)
+	if updated {
+		logger.Default.Info(req.RequestId, "Vipspt[PostJSON]limit updated", logger.Fields{
+			"api":   req.ApiName,
+			"limit": limitOpts,
+		})
+	}
+	release, err := lim.Acquire(ctx)
 	if err != nil {
+		logger.Default.Warn(req.RequestId, "Vipspt[PostJSON]limit", logger.Fields{
+			"api":   req.ApiName,
+			"error": err,
+		})
 		return err
 	}
+	defer release()
+	// 按网关地址及接口熔断 熔断打开时直接返回通道不可用
+	breakers := c.Breakers
+	if breakers == nil {
+		breakers = breaker.Default
+	}
+	br := breakers.Get(c.APIBaseURL() + " " + req.ApiName)
+	if err := br.Allow(req.RequestId); err != nil {
+		logger.Default.Warn(req.RequestId, "Vipspt[PostJSON]breaker", logger.Fields{
+			"api":   req.ApiName,
+			"error": err,
+		})
+		return err
+	}
+	start := time.Now()
+	res, err := util.PostJSONWithContext(ctx, c.Doer, apiUrl, params)
+	switch {
+	case err == nil:
+		br.Report(req.RequestId, true)
+	// 调用方取消 商户代理及本地配置导致的失败不计入网关失败
+	case ctx.Err() != nil || con.Transport.Proxy != "" || !gatewayFailure(err, time.Since(start), br.Options().MinTimeout):
+		br.Release()
+	default:
+		br.Report(req.RequestId, false)
+	}
+	if err != nil {
+		logger.Default.Error(req.RequestId, "Vipspt[PostJSON]res", logger.Fields{
+			"api":   req.ApiName,
+			"error": err,
+		})
+		return &NetworkError{ApiName: req.ApiName, Err: err}
+	}
+	logger.Default.Info(req.RequestId, "Vipspt[PostJSON]res", logger.Fields{
+		"api":      req.ApiName,
+		"response": logger.Body(res),
+	})
 	response.SetHttpContent(res, "string")
 	return
 }
+
+// gatewayFailure 是否为网关故障 连接网关失败 网关超时及 5xx 计入
+// TLS 证书 公钥锁定 代理错误及短于 minTimeout 的超时为本地配置导致 不计入
+func gatewayFailure(err error, elapsed, minTimeout time.Duration) bool {
+	var statusErr *util.StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= 500
+	}
+	var (
+		unknownAuthority x509.UnknownAuthorityError
+		hostname         x509.HostnameError
+		invalid          x509.CertificateInvalidError
+		recordHeader     tls.RecordHeaderError
+	)
+	if errors.Is(err, util.ErrPinMismatch) || errors.As(err, &unknownAuthority) || errors.As(err, &hostname) ||
+		errors.As(err, &invalid) || errors.As(err, &recordHeader) {
+		return false
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		switch opErr.Op {
+		case "proxyconnect", "remote error", "local error": // 代理连接失败 TLS 握手被拒绝
+			return false
+		}
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return elapsed >= minTimeout
+	}
+	return opErr != nil || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
@@ -0,0 +1,54 @@
+package common
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/lecex/vipspt/service/util"
+)
+
+// timeoutError 超时错误
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func urlError(err error) error {
+	return &url.Error{Op: "Post", URL: "https://gateway.example.com/payOpen/bToC", Err: err}
+}
+
+func TestGatewayFailure(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		elapsed time.Duration
+		want    bool
+	}{
+		{"5xx", &util.StatusError{StatusCode: 502}, 0, true},
+		{"4xx", &util.StatusError{StatusCode: 403}, 0, false},
+		{"connection refused", urlError(&net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}), 0, true},
+		{"connection reset", urlError(&net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}), 0, true},
+		{"eof", urlError(io.EOF), 0, true},
+		{"gateway timeout", urlError(timeoutError{}), 30 * time.Second, true},
+		{"short merchant timeout", urlError(timeoutError{}), 100 * time.Millisecond, false},
+		{"pin mismatch", urlError(util.ErrPinMismatch), 0, false},
+		{"unknown authority", urlError(x509.UnknownAuthorityError{}), 0, false},
+		{"hostname", urlError(x509.HostnameError{Host: "gateway.example.com"}), 0, false},
+		{"proxy", urlError(&net.OpError{Op: "proxyconnect", Net: "tcp", Err: syscall.ECONNREFUSED}), 0, false},
+		{"client cert rejected", urlError(&net.OpError{Op: "remote error", Err: errors.New("tls: bad certificate")}), 0, false},
+		{"other", urlError(fmt.Errorf("unsupported protocol scheme")), 0, false},
+	}
+	for _, tt := range tests {
+		if got := gatewayFailure(tt.err, tt.elapsed, 5*time.Second); got != tt.want {
+			t.Errorf("%s: gatewayFailure = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
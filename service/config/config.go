@@ -1,13 +1,93 @@
 package config
 
+import (
+	"time"
+)
+
 type Config struct {
-	Appid         string `json:"appid"`          //分配给开发者的应用ID
-	SecretKey     string `json:"secret_key"`     //私钥
-	MerchantId    string `json:"merchant_id"`    // 商户号
-	EnterpriseReg string `json:"enterprise_reg"` // 商户注册编码
-	SignType      string `json:"sign_type"`      //签名类型
-	Sign          string `json:"sign"`           //商户请求参数的签名串
-	NotifyUrl     string `json:"notify_url"`     //服务器主动通知商户服务器里指定的页面http/https路径。
-	BizContent    string `json:"biz_content"`    //业务请求参数的集合，最大长度不限，除公共参数外所有请求参数都必须放在这个参数中传递，具体参照各产品快速接入文档
-	Sandbox       bool   `json:"sandbox"`        // 沙盒
+	Appid              string           `json:"appid"`                //分配给开发者的应用ID
+	SecretKey          string           `json:"secret_key"`           //私钥
+	PublicKey          string           `json:"public_key"`           //平台公钥 验证 sSignature 签名
+	PublicKeySecondary string           `json:"public_key_secondary"` // 轮换前的旧平台公钥 过渡期内验签同时接受
+	KeyOverlapUntil    time.Time        `json:"key_overlap_until"`    // 旧平台公钥过渡期截止时间 为空时不接受旧公钥
+	MerchantId         string           `json:"merchant_id"`          // 商户号
+	EnterpriseReg      string           `json:"enterprise_reg"`       // 商户注册编码
+	SignType           string           `json:"sign_type"`            //请求签名类型 MD5 SHA1 SHA256(默认) SM3 RSA2 SM2
+	VerifySignType     string           `json:"verify_sign_type"`     // 平台签名类型 RSA(默认) RSA2 SM2 返回数据及通知使用平台公钥验签
+	Sign               string           `json:"sign"`                 //商户请求参数的签名串
+	NotifyUrl          string           `json:"notify_url"`           //服务器主动通知商户服务器里指定的页面http/https路径。
+	BizContent         string           `json:"biz_content"`          //业务请求参数的集合，最大长度不限，除公共参数外所有请求参数都必须放在这个参数中传递，具体参照各产品快速接入文档
+	Sandbox            bool             `json:"sandbox"`              // 沙盒
+	BaseUrl            string           `json:"base_url"`             // 当前环境网关地址 为空时使用默认地址 取自运维配置 Gateway
+	CaBundle           string           `json:"ca_bundle"`            // 当前环境自定义 CA 证书 PEM 文本或文件路径 取自运维配置 Gateway
+	Pins               []string         `json:"pins"`                 // 当前环境证书公钥锁定 base64(sha256(SPKI)) 取自运维配置 Gateway
+	Strict             bool             `json:"strict"`               // 严格模式 生产环境禁止使用 http 取自运维配置
+	Cert               string           `json:"cert"`                 // 商户客户端证书 PKCS#12 文件路径或 base64, PEM 文本或文件路径
+	CertKey            string           `json:"cert_key"`             // PEM 证书私钥 为空时 Cert 为 PKCS#12
+	CertPassword       string           `json:"cert_password"`        // PKCS#12 证书密码
+	CertDir            string           `json:"cert_dir"`             // 证书文件允许目录 取自运维配置
+	Transport          Transport        `json:"transport"`            // 当前环境 HTTP 连接配置
+	Retry              Retry            `json:"retry"`                // 网关请求失败重试配置
+	Limit              Limit            `json:"limit"`                // 商户出站限流 各接口独立计算
+	Limits             map[string]Limit `json:"limits"`               // 按 ApiName 覆盖 Limit
+}
+
+// Gateway 网关环境配置 由运维按沙盒及生产环境分别配置 不接受请求传入
+type Gateway struct {
+	BaseUrl  string   `json:"base_url"`  // 网关地址 为空时使用默认地址
+	CaBundle string   `json:"ca_bundle"` // 自定义 CA 证书 PEM 文本或文件路径
+	Pins     []string `json:"pins"`      // 证书公钥锁定 base64(sha256(SPKI))
+}
+
+// Transport 当前环境 HTTP 连接配置 零值使用默认值
+type Transport struct {
+	ConnectTimeout      time.Duration `json:"connect_timeout"`         // 连接超时
+	ReadTimeout         time.Duration `json:"read_timeout"`            // 等待响应超时
+	Timeout             time.Duration `json:"timeout"`                 // 请求总超时
+	MaxIdleConns        int           `json:"max_idle_conns"`          // 最大空闲连接
+	MaxIdleConnsPerHost int           `json:"max_idle_conns_per_host"` // 每个主机最大空闲连接
+	Proxy               string        `json:"proxy"`                   // HTTP 代理
+	KeepAlive           time.Duration `json:"keep_alive"`              // TCP keep-alive 间隔 小于 0 时禁用连接复用
+}
+
+// Retry 网关请求失败重试配置 零值使用默认值
+type Retry struct {
+	MaxAttempts    int           `json:"max_attempts"`    // 最大请求次数 默认 3 为 1 时不重试
+	BaseDelay      time.Duration `json:"base_delay"`      // 首次重试等待 默认 200ms
+	MaxDelay       time.Duration `json:"max_delay"`       // 最大重试等待 默认 2s
+	ResolveTimeout time.Duration `json:"resolve_timeout"` // 调用方已取消时查询确认结果的超时 默认 10s
+}
+
+// Limit 商户出站限流 按 Appid MerchantId 及接口计算 零值不限制
+type Limit struct {
+	Rate          float64       `json:"rate"`           // 每秒请求数
+	Burst         int           `json:"burst"`          // 令牌桶容量 默认 Rate 向上取整
+	MaxConcurrent int           `json:"max_concurrent"` // 最大并发请求
+	QueueTimeout  time.Duration `json:"queue_timeout"`  // 超限时排队等待时间 0 时直接返回错误
+}
+
+// ApiLimit 接口限流配置
+func (c *Config) ApiLimit(apiName string) Limit {
+	if l, ok := c.Limits[apiName]; ok {
+		return l
+	}
+	return c.Limit
+}
+
+// VerifyKeys 验签平台公钥 主密钥在前 过渡期内包含旧密钥
+func (c *Config) VerifyKeys() []string {
+	return c.verifyKeys(time.Now())
+}
+
+func (c *Config) verifyKeys(now time.Time) []string {
+	return overlapKeys(now, c.PublicKey, c.PublicKeySecondary, c.KeyOverlapUntil)
+}
+
+// overlapKeys 截止时间前包含旧密钥 未设置截止时间时不包含
+func overlapKeys(now time.Time, primary, secondary string, until time.Time) []string {
+	keys := []string{primary}
+	if secondary != "" && !until.IsZero() && now.Before(until) {
+		keys = append(keys, secondary)
+	}
+	return keys
 }
@@ -0,0 +1,33 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestVerifyKeysOverlap(t *testing.T) {
+	cutoff := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		c    Config
+		want []string
+	}{
+		{"public", Config{PublicKey: "new", PublicKeySecondary: "old", KeyOverlapUntil: cutoff}, []string{"new", "old"}},
+		// 摘要签名类型仍使用平台公钥验签
+		{"digest sign type", Config{SignType: "SHA256", SecretKey: "secret", PublicKey: "new", PublicKeySecondary: "old", KeyOverlapUntil: cutoff}, []string{"new", "old"}},
+	}
+	for _, tt := range tests {
+		if got := tt.c.verifyKeys(cutoff.Add(-time.Second)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s before cutoff = %v, want %v", tt.name, got, tt.want)
+		}
+		if got := tt.c.verifyKeys(cutoff); !reflect.DeepEqual(got, tt.want[:1]) {
+			t.Errorf("%s at cutoff = %v, want %v", tt.name, got, tt.want[:1])
+		}
+	}
+	// 未设置截止时间时不接受旧密钥
+	c := Config{PublicKey: "new", PublicKeySecondary: "old"}
+	if got := c.verifyKeys(cutoff.AddDate(-10, 0, 0)); !reflect.DeepEqual(got, []string{"new"}) {
+		t.Errorf("no cutoff = %v", got)
+	}
+}
@@ -0,0 +1,25 @@
+package config
+
+// PayWays 支付方式对应 vipspt pay_way
+var PayWays = map[string]string{
+	"wechat":   "WXZF",  // 微信支付
+	"alipay":   "ZFBZF", // 支付宝
+	"unionpay": "YLZF",  // 银联云闪付
+	"dcep":     "SZRMB", // 数字人民币
+}
+
+// PayWay 获取支付方式对应的 pay_way
+func PayWay(method string) (payWay string, ok bool) {
+	payWay, ok = PayWays[method]
+	return
+}
+
+// PayMethod 根据 pay_way 获取支付方式
+func PayMethod(payWay string) string {
+	for method, v := range PayWays {
+		if v == payWay {
+			return method
+		}
+	}
+	return ""
+}
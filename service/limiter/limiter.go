@@ -0,0 +1,186 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrRateLimited 超出请求频率限制
+	ErrRateLimited = errors.New("vipspt rate limited")
+	// ErrConcurrencyLimited 超出并发限制
+	ErrConcurrencyLimited = errors.New("vipspt concurrency limited")
+)
+
+// LimitError 超出限制 errors.Is 可匹配 ErrRateLimited ErrConcurrencyLimited
+type LimitError struct {
+	Key string
+	Err error
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%v: %s", e.Err, e.Key)
+}
+
+// Unwrap 原始错误
+func (e *LimitError) Unwrap() error {
+	return e.Err
+}
+
+// Options 限流配置 零值不限制
+type Options struct {
+	Rate          float64       // 令牌桶每秒请求数 0 不限制
+	Burst         int           // 令牌桶容量 默认 Rate 向上取整
+	MaxConcurrent int           // 最大并发请求 0 不限制
+	QueueTimeout  time.Duration // 超限时排队等待时间 0 时直接返回错误
+}
+
+func (o Options) withDefaults() Options {
+	if o.Rate > 0 && o.Burst <= 0 {
+		o.Burst = int(math.Ceil(o.Rate))
+	}
+	return o
+}
+
+// Limiter 令牌桶限流及并发隔离
+type Limiter struct {
+	key    string
+	opts   Options
+	sem    chan struct{}
+	mu     sync.Mutex // 保护 tokens last
+	tokens float64
+	last   time.Time
+}
+
+// New 创建限流 配置在创建时确定
+func New(key string, opts Options) *Limiter {
+	opts = opts.withDefaults()
+	l := &Limiter{
+		key:    key,
+		opts:   opts,
+		tokens: float64(opts.Burst), // 令牌桶初始为满
+	}
+	if opts.MaxConcurrent > 0 {
+		l.sem = make(chan struct{}, opts.MaxConcurrent)
+	}
+	return l
+}
+
+// Acquire 获取请求许可 成功后必须调用 release 释放并发许可
+// 超限时在 QueueTimeout 内排队 超时或未配置排队时返回 *LimitError
+// 未获得并发许可时归还令牌
+func (l *Limiter) Acquire(ctx context.Context) (release func(), err error) {
+	deadline := time.Now().Add(l.opts.QueueTimeout)
+	if err := l.wait(ctx, deadline); err != nil {
+		return nil, err
+	}
+	if l.sem == nil {
+		return func() {}, nil
+	}
+	release = func() { <-l.sem }
+	select {
+	case l.sem <- struct{}{}:
+		return release, nil
+	default:
+	}
+	d := time.Until(deadline)
+	if d <= 0 {
+		l.refund()
+		return nil, &LimitError{Key: l.key, Err: ErrConcurrencyLimited}
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case l.sem <- struct{}{}:
+		return release, nil
+	case <-timer.C:
+		l.refund()
+		return nil, &LimitError{Key: l.key, Err: ErrConcurrencyLimited}
+	case <-ctx.Done():
+		l.refund()
+		return nil, ctx.Err()
+	}
+}
+
+// refund 归还令牌
+func (l *Limiter) refund() {
+	if l.opts.Rate <= 0 {
+		return
+	}
+	l.mu.Lock()
+	l.tokens++
+	l.mu.Unlock()
+}
+
+// wait 令牌桶取令牌 需等待时预留令牌 超过 deadline 时返回错误
+func (l *Limiter) wait(ctx context.Context, deadline time.Time) error {
+	if l.opts.Rate <= 0 {
+		return nil
+	}
+	l.mu.Lock()
+	now := time.Now()
+	if !l.last.IsZero() {
+		l.tokens += now.Sub(l.last).Seconds() * l.opts.Rate
+	}
+	if burst := float64(l.opts.Burst); l.tokens > burst {
+		l.tokens = burst
+	}
+	l.last = now
+	var d time.Duration
+	if l.tokens < 1 {
+		d = time.Duration((1 - l.tokens) / l.opts.Rate * float64(time.Second))
+	}
+	if d > 0 && now.Add(d).After(deadline) {
+		l.mu.Unlock()
+		return &LimitError{Key: l.key, Err: ErrRateLimited}
+	}
+	l.tokens--
+	l.mu.Unlock()
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		// 取消时归还预留的令牌
+		l.refund()
+		return ctx.Err()
+	}
+}
+
+// Registry 按 key 管理限流
+type Registry struct {
+	mu       sync.Mutex
+	limiters map[string]*Limiter
+}
+
+// Default 默认限流
+var Default = NewRegistry()
+
+// NewRegistry 创建限流管理
+func NewRegistry() *Registry {
+	return &Registry{
+		limiters: map[string]*Limiter{},
+	}
+}
+
+// Get 获取限流 不存在或配置变更时按 opts 重新创建 updated 表示配置已变更
+// 重新创建前已获得的并发许可仍在原限流中释放
+func (r *Registry) Get(key string, opts Options) (l *Limiter, updated bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	l, ok := r.limiters[key]
+	if ok && l.opts == opts.withDefaults() {
+		return l, false
+	}
+	l = New(key, opts)
+	r.limiters[key] = l
+	return l, ok
+}
@@ -0,0 +1,98 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRateLimit(t *testing.T) {
+	l := New("rate", Options{Rate: 1, Burst: 2})
+	for i := 0; i < 2; i++ {
+		if _, err := l.Acquire(context.Background()); err != nil {
+			t.Fatalf("burst %d: %v", i, err)
+		}
+	}
+	if _, err := l.Acquire(context.Background()); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("fail fast = %v, want ErrRateLimited", err)
+	}
+
+	l = New("rate-queue", Options{Rate: 50, Burst: 1, QueueTimeout: time.Second})
+	start := time.Now()
+	for i := 0; i < 2; i++ {
+		if _, err := l.Acquire(context.Background()); err != nil {
+			t.Fatalf("queue %d: %v", i, err)
+		}
+	}
+	if d := time.Since(start); d < 15*time.Millisecond {
+		t.Errorf("queued for %s, want about 20ms", d)
+	}
+}
+
+func TestConcurrencyLimit(t *testing.T) {
+	l := New("bulkhead", Options{MaxConcurrent: 1, QueueTimeout: 10 * time.Millisecond})
+	release, err := l.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Acquire(context.Background()); !errors.Is(err, ErrConcurrencyLimited) {
+		t.Fatalf("full = %v, want ErrConcurrencyLimited", err)
+	}
+	release()
+	if _, err := l.Acquire(context.Background()); err != nil {
+		t.Fatalf("after release: %v", err)
+	}
+}
+
+func TestConcurrencyRefundsToken(t *testing.T) {
+	l := New("refund", Options{Rate: 1, Burst: 2, MaxConcurrent: 1})
+	release, err := l.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 并发超限时不消耗令牌
+	for i := 0; i < 3; i++ {
+		if _, err := l.Acquire(context.Background()); !errors.Is(err, ErrConcurrencyLimited) {
+			t.Fatalf("full %d = %v, want ErrConcurrencyLimited", i, err)
+		}
+	}
+	release()
+	if _, err := l.Acquire(context.Background()); err != nil {
+		t.Fatalf("after release: %v", err)
+	}
+}
+
+func TestRegistryUpdatesOptions(t *testing.T) {
+	r := NewRegistry()
+	l, updated := r.Get("merchant", Options{MaxConcurrent: 1})
+	if updated {
+		t.Error("new limiter reported as updated")
+	}
+	release, err := l.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 相同配置复用限流 默认 Burst 视为相同配置
+	if got, updated := r.Get("merchant", Options{MaxConcurrent: 1}); got != l || updated {
+		t.Fatal("same options rebuilt the limiter")
+	}
+	rate, _ := r.Get("rate", Options{Rate: 2})
+	if got, updated := r.Get("rate", Options{Rate: 2, Burst: 2}); got != rate || updated {
+		t.Fatal("default burst rebuilt the limiter")
+	}
+	if _, err := l.Acquire(context.Background()); !errors.Is(err, ErrConcurrencyLimited) {
+		t.Fatalf("full = %v, want ErrConcurrencyLimited", err)
+	}
+	// 配置变更时重新创建 使用新配置
+	got, updated := r.Get("merchant", Options{MaxConcurrent: 2})
+	if got == l || !updated {
+		t.Fatal("changed options did not rebuild the limiter")
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := got.Acquire(context.Background()); err != nil {
+			t.Fatalf("acquire %d: %v", i, err)
+		}
+	}
+	release()
+}
@@ -0,0 +1,210 @@
+package logger
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/micro/go-micro/v2/util/log"
+)
+
+// Level 日志级别
+type Level int
+
+const (
+	DebugLevel Level = iota
+	InfoLevel
+	WarnLevel
+	ErrorLevel
+)
+
+var levelNames = map[Level]string{
+	DebugLevel: "debug",
+	InfoLevel:  "info",
+	WarnLevel:  "warn",
+	ErrorLevel: "error",
+}
+
+// ParseLevel 解析日志级别 默认 info
+func ParseLevel(level string) Level {
+	for k, v := range levelNames {
+		if v == strings.ToLower(level) {
+			return k
+		}
+	}
+	return InfoLevel
+}
+
+// Fields 日志字段
+type Fields map[string]interface{}
+
+// Mask 脱敏规则
+type Mask func(v string) string
+
+// MaskAll 全部隐藏
+func MaskAll(v string) string {
+	return "***"
+}
+
+// MaskMiddle 保留首尾各 3 位
+func MaskMiddle(v string) string {
+	if len(v) <= 8 {
+		return "***"
+	}
+	return v[:3] + "***" + v[len(v)-3:]
+}
+
+// DefaultRules 默认脱敏字段 字段名不区分大小写
+var DefaultRules = map[string]Mask{
+	"sign":          MaskAll,    // 请求签名
+	"ssignature":    MaskAll,    // 返回签名
+	"secretkey":     MaskAll,    // 商户密钥
+	"secret_key":    MaskAll,    // 商户密钥
+	"appsecret":     MaskAll,    // 商户密钥
+	"rawdata":       MaskAll,    // 刷脸初始化数据
+	"authinfo":      MaskAll,    // 刷脸调用凭证
+	"paysign":       MaskAll,    // 调起支付签名
+	"sauthcode":     MaskMiddle, // 付款码
+	"sub_openid":    MaskMiddle, // 用户标识
+	"openid":        MaskMiddle, // 用户标识
+	"buyer_id":      MaskMiddle, // 用户标识
+	"appid":         MaskMiddle, // 商户应用
+	"merchant_id":   MaskMiddle, // 商户号
+	"mch_id":        MaskMiddle, // 微信商户号
+	"sub_mch_id":    MaskMiddle, // 微信子商户号
+	"enterprisereg": MaskMiddle, // 商户注册编码
+}
+
+// Logger 结构化日志 按字段名脱敏 每条日志带 request_id
+type Logger struct {
+	Level Level
+	Rules map[string]Mask
+}
+
+// Default 默认日志 级别由 PAY_VIPSPT_LOG_LEVEL 配置
+var Default = New(ParseLevel(os.Getenv("PAY_VIPSPT_LOG_LEVEL")))
+
+// New 创建日志
+func New(level Level) *Logger {
+	return &Logger{
+		Level: level,
+		Rules: DefaultRules,
+	}
+}
+
+// Debug 调试日志
+func (l *Logger) Debug(requestId string, msg string, fields Fields) {
+	l.Log(DebugLevel, requestId, msg, fields)
+}
+
+// Info 信息日志
+func (l *Logger) Info(requestId string, msg string, fields Fields) {
+	l.Log(InfoLevel, requestId, msg, fields)
+}
+
+// Warn 警告日志
+func (l *Logger) Warn(requestId string, msg string, fields Fields) {
+	l.Log(WarnLevel, requestId, msg, fields)
+}
+
+// Error 错误日志
+func (l *Logger) Error(requestId string, msg string, fields Fields) {
+	l.Log(ErrorLevel, requestId, msg, fields)
+}
+
+// Log 输出脱敏后的 JSON 日志
+func (l *Logger) Log(level Level, requestId string, msg string, fields Fields) {
+	if level < l.Level {
+		return
+	}
+	entry := map[string]interface{}{}
+	for k, v := range fields {
+		entry[k] = l.Redact(k, v)
+	}
+	entry["level"] = levelNames[level]
+	entry["time"] = time.Now().Format(time.RFC3339Nano)
+	entry["request_id"] = requestId
+	entry["msg"] = msg
+	b, err := json.Marshal(entry)
+	if err != nil {
+		b = []byte(msg + " " + err.Error())
+	}
+	switch level {
+	case DebugLevel:
+		log.Debug(string(b))
+	case InfoLevel:
+		log.Info(string(b))
+	case WarnLevel:
+		log.Warn(string(b))
+	default:
+		log.Error(string(b))
+	}
+}
+
+// Redact 按字段名脱敏 递归处理 map 数组及 JSON 字符串(如 jspay_info)
+func (l *Logger) Redact(key string, v interface{}) interface{} {
+	if mask, ok := l.Rules[strings.ToLower(key)]; ok && v != nil {
+		if s, ok := v.(string); ok {
+			return mask(s)
+		}
+		b, _ := json.Marshal(v)
+		return mask(string(b))
+	}
+	switch val := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			m[k] = l.Redact(k, item)
+		}
+		return m
+	case Fields:
+		return l.Redact(key, map[string]interface{}(val))
+	case []interface{}:
+		s := make([]interface{}, len(val))
+		for i, item := range val {
+			s[i] = l.Redact(key, item)
+		}
+		return s
+	case string:
+		return l.redactJSON(key, val)
+	case error:
+		return val.Error()
+	}
+	return v
+}
+
+// redactJSON 脱敏 JSON 对象或数组字符串 非 JSON 时返回原文
+func (l *Logger) redactJSON(key string, s string) string {
+	trimmed := strings.TrimSpace(s)
+	if !strings.HasPrefix(trimmed, "{") && !strings.HasPrefix(trimmed, "[") {
+		return s
+	}
+	var v interface{}
+	if err := json.Unmarshal([]byte(trimmed), &v); err != nil {
+		return s
+	}
+	b, err := json.Marshal(l.Redact(key, v))
+	if err != nil {
+		return s
+	}
+	return string(b)
+}
+
+// Body 解析 JSON 返回内容以便脱敏 非 JSON 时返回原文
+func Body(b []byte) interface{} {
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return string(b)
+	}
+	return v
+}
+
+// NewRequestId 创建请求 ID
+func NewRequestId() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,81 @@
+package logger
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestMask(t *testing.T) {
+	for v, want := range map[string]string{
+		"":                   "***",
+		"12345678":           "***",
+		"134567890123456789": "134***789",
+	} {
+		if got := MaskMiddle(v); got != want {
+			t.Errorf("MaskMiddle(%q) = %q, want %q", v, got, want)
+		}
+	}
+	if got := MaskAll("secret"); got != "***" {
+		t.Errorf("MaskAll = %q", got)
+	}
+}
+
+func TestRedact(t *testing.T) {
+	l := New(InfoLevel)
+	tests := []struct {
+		key  string
+		v    interface{}
+		want interface{}
+	}{
+		{"sign", "abc", "***"},
+		{"sSignature", "abc", "***"},
+		{"SecretKey", "abc", "***"},
+		{"sAuthCode", "134567890123456789", "134***789"},
+		{"sub_openid", "oUpF8uMuAJO_M2pxb1Q9zNjWeS6o", "oUp***S6o"},
+		{"out_order_id", "20210622134855", "20210622134855"},
+		{"amount", 1.5, 1.5},
+		{"error", errors.New("failed"), "failed"},
+		// 非字符串值按 JSON 脱敏
+		{"sign", map[string]interface{}{"a": "b"}, "***"},
+		{"data", map[string]interface{}{
+			"sAuthCode":    "134567890123456789",
+			"out_order_id": "1",
+			"nested":       map[string]interface{}{"secret_key": "abc"},
+		}, map[string]interface{}{
+			"sAuthCode":    "134***789",
+			"out_order_id": "1",
+			"nested":       map[string]interface{}{"secret_key": "***"},
+		}},
+		{"data", []interface{}{
+			map[string]interface{}{"openid": "oUpF8uMuAJO_M2pxb1Q9zNjWeS6o"},
+		}, []interface{}{
+			map[string]interface{}{"openid": "oUp***S6o"},
+		}},
+		{"fields", Fields{"appid": "wx1234567890"}, map[string]interface{}{"appid": "wx1***890"}},
+		{"data", map[string]interface{}{"mch_id": "1230000109", "sub_mch_id": "1900000109"}, map[string]interface{}{"mch_id": "123***109", "sub_mch_id": "190***109"}},
+		// JSON 字符串解析后脱敏
+		{"jspay_info", `{"appId":"wx1234567890","paySign":"abc","package":"prepay_id=1"}`, `{"appId":"wx1***890","package":"prepay_id=1","paySign":"***"}`},
+		{"data", map[string]interface{}{"jspay_info": `{"paySign":"abc"}`}, map[string]interface{}{"jspay_info": `{"paySign":"***"}`}},
+		{"msg", "{not json", "{not json"},
+	}
+	for _, tt := range tests {
+		if got := l.Redact(tt.key, tt.v); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Redact(%s, %v) = %v, want %v", tt.key, tt.v, got, tt.want)
+		}
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for v, want := range map[string]Level{
+		"debug": DebugLevel,
+		"WARN":  WarnLevel,
+		"error": ErrorLevel,
+		"":      InfoLevel,
+		"x":     InfoLevel,
+	} {
+		if got := ParseLevel(v); got != want {
+			t.Errorf("ParseLevel(%q) = %v, want %v", v, got, want)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package replay
+
+import (
+	"container/heap"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// ErrReplay 通知重复 原通知正在处理
+	ErrReplay = errors.New("vipspt notify replayed")
+	// ErrExpired 通知时间超出允许窗口
+	ErrExpired = errors.New("vipspt notify timestamp out of window")
+	// ErrProcessed 通知已处理成功 重复通知直接应答成功 不再转发
+	ErrProcessed = errors.New("vipspt notify already processed")
+)
+
+// Store 防重放存储 默认内存存储 多实例部署时可替换为共享存储
+type Store interface {
+	// Add 记录 key 有效期 ttl, key 已存在时返回 false
+	Add(key string, ttl time.Duration) (ok bool, err error)
+	// Exists key 是否存在且未过期
+	Exists(key string) (ok bool, err error)
+	// Remove 删除 key
+	Remove(key string) error
+}
+
+// Guard 通知防重放
+type Guard struct {
+	Store    Store
+	Window   time.Duration // 允许的时间窗口
+	rejected uint64
+}
+
+// NewGuard 创建防重放
+func NewGuard(store Store, window time.Duration) *Guard {
+	return &Guard{
+		Store:  store,
+		Window: window,
+	}
+}
+
+// Check 校验通知 已处理成功的返回 ErrProcessed 时间超出窗口返回 ErrExpired 正在处理的返回 ErrReplay
+func (g *Guard) Check(timestamp time.Time, nonce string) (err error) {
+	processed, err := g.Store.Exists(processedKey(nonce))
+	if err != nil {
+		return err
+	}
+	if processed {
+		atomic.AddUint64(&g.rejected, 1)
+		return ErrProcessed
+	}
+	if d := time.Since(timestamp); d > g.Window || d < -g.Window {
+		atomic.AddUint64(&g.rejected, 1)
+		return ErrExpired
+	}
+	ok, err := g.Store.Add(nonce, 2*g.Window)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		atomic.AddUint64(&g.rejected, 1)
+		return ErrReplay
+	}
+	return nil
+}
+
+// Done 标记通知处理成功 之后的重复通知返回 ErrProcessed
+func (g *Guard) Done(nonce string) error {
+	_, err := g.Store.Add(processedKey(nonce), 2*g.Window)
+	return err
+}
+
+// Release 释放 nonce 处理失败时允许平台重新通知
+func (g *Guard) Release(nonce string) error {
+	return g.Store.Remove(nonce)
+}
+
+// Rejected 已拒绝的通知数量
+func (g *Guard) Rejected() uint64 {
+	return atomic.LoadUint64(&g.rejected)
+}
+
+func processedKey(nonce string) string {
+	return "processed:" + nonce
+}
+
+// MemoryStore 内存存储 超过 max 时淘汰最早过期的 key
+type MemoryStore struct {
+	mu      sync.Mutex
+	max     int
+	keys    map[string]time.Time
+	expires expireHeap // 按过期时间排序 Add 覆盖或 Remove 的旧记录在出堆时忽略
+}
+
+// NewMemoryStore 创建内存存储
+func NewMemoryStore(max int) *MemoryStore {
+	return &MemoryStore{
+		max:  max,
+		keys: map[string]time.Time{},
+	}
+}
+
+// Add 记录 key
+func (s *MemoryStore) Add(key string, ttl time.Duration) (ok bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if expire, ok := s.keys[key]; ok && expire.After(now) {
+		return false, nil
+	}
+	s.evict(now)
+	expire := now.Add(ttl)
+	s.keys[key] = expire
+	heap.Push(&s.expires, expireItem{key: key, expire: expire})
+	return true, nil
+}
+
+// Exists key 是否存在且未过期
+func (s *MemoryStore) Exists(key string) (ok bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	expire, ok := s.keys[key]
+	return ok && expire.After(time.Now()), nil
+}
+
+// Remove 删除 key
+func (s *MemoryStore) Remove(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.keys, key)
+	return nil
+}
+
+// Len 当前记录数量
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.keys)
+}
+
+// evict 按过期时间出堆 清理过期 key 仍超出时淘汰最早过期的 key
+func (s *MemoryStore) evict(now time.Time) {
+	// Remove 留下的旧记录过多时重建
+	if s.expires.Len() > 2*len(s.keys)+s.max {
+		s.expires = s.expires[:0]
+		for k, v := range s.keys {
+			s.expires = append(s.expires, expireItem{key: k, expire: v})
+		}
+		heap.Init(&s.expires)
+	}
+	for s.expires.Len() > 0 {
+		item := s.expires[0]
+		expire, ok := s.keys[item.key]
+		if ok && expire.Equal(item.expire) && expire.After(now) && len(s.keys) < s.max {
+			return
+		}
+		heap.Pop(&s.expires)
+		if ok && expire.Equal(item.expire) {
+			delete(s.keys, item.key)
+		}
+	}
+}
+
+type expireItem struct {
+	key    string
+	expire time.Time
+}
+
+// expireHeap 过期时间最小堆
+type expireHeap []expireItem
+
+func (h expireHeap) Len() int            { return len(h) }
+func (h expireHeap) Less(i, j int) bool  { return h[i].expire.Before(h[j].expire) }
+func (h expireHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *expireHeap) Push(x interface{}) { *h = append(*h, x.(expireItem)) }
+func (h *expireHeap) Pop() interface{} {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
@@ -0,0 +1,104 @@
+package replay
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestGuardCheck(t *testing.T) {
+	g := NewGuard(NewMemoryStore(100), time.Minute)
+	now := time.Now()
+	if err := g.Check(now, "a"); err != nil {
+		t.Fatal(err)
+	}
+	// 原通知处理中
+	if err := g.Check(now, "a"); !errors.Is(err, ErrReplay) {
+		t.Errorf("in flight: err = %v, want ErrReplay", err)
+	}
+	// 处理失败释放后允许重新通知
+	g.Release("a")
+	if err := g.Check(now, "a"); err != nil {
+		t.Errorf("released: err = %v", err)
+	}
+	// 处理成功后的重复通知
+	g.Done("a")
+	if err := g.Check(now, "a"); !errors.Is(err, ErrProcessed) {
+		t.Errorf("processed: err = %v, want ErrProcessed", err)
+	}
+	// 已处理的通知即使超出时间窗口也应答成功
+	if err := g.Check(now.Add(-time.Hour), "a"); !errors.Is(err, ErrProcessed) {
+		t.Errorf("processed expired: err = %v, want ErrProcessed", err)
+	}
+	for _, ts := range []time.Time{now.Add(-2 * time.Minute), now.Add(2 * time.Minute)} {
+		if err := g.Check(ts, "b"); !errors.Is(err, ErrExpired) {
+			t.Errorf("%s: err = %v, want ErrExpired", ts, err)
+		}
+	}
+	if g.Rejected() != 5 {
+		t.Errorf("Rejected = %d, want 5", g.Rejected())
+	}
+}
+
+func TestMemoryStoreExpire(t *testing.T) {
+	s := NewMemoryStore(100)
+	if ok, _ := s.Add("a", 20*time.Millisecond); !ok {
+		t.Fatal("Add a failed")
+	}
+	if ok, _ := s.Exists("a"); !ok {
+		t.Error("a not exists")
+	}
+	if ok, _ := s.Add("a", time.Minute); ok {
+		t.Error("duplicate a added")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if ok, _ := s.Exists("a"); ok {
+		t.Error("expired a exists")
+	}
+	if ok, _ := s.Add("a", time.Minute); !ok {
+		t.Error("expired a not re-added")
+	}
+	s.Remove("a")
+	if ok, _ := s.Exists("a"); ok {
+		t.Error("removed a exists")
+	}
+}
+
+func TestMemoryStoreEvict(t *testing.T) {
+	s := NewMemoryStore(3)
+	s.Add("late", 3*time.Minute)
+	s.Add("early", time.Minute)
+	s.Add("middle", 2*time.Minute)
+	// 超出时淘汰最早过期的 key 而非最早写入的 key
+	s.Add("new", 4*time.Minute)
+	if s.Len() != 3 {
+		t.Errorf("Len = %d, want 3", s.Len())
+	}
+	for key, want := range map[string]bool{"late": true, "early": false, "middle": true, "new": true} {
+		if ok, _ := s.Exists(key); ok != want {
+			t.Errorf("%s exists = %v, want %v", key, ok, want)
+		}
+	}
+
+	// 过期 key 先于未过期 key 清理
+	s = NewMemoryStore(2)
+	s.Add("expired", time.Millisecond)
+	s.Add("live", time.Minute)
+	time.Sleep(5 * time.Millisecond)
+	s.Add("new", time.Minute)
+	for key, want := range map[string]bool{"expired": false, "live": true, "new": true} {
+		if ok, _ := s.Exists(key); ok != want {
+			t.Errorf("%s exists = %v, want %v", key, ok, want)
+		}
+	}
+
+	// 反复 Remove 后堆不会无限增长
+	s = NewMemoryStore(10)
+	for i := 0; i < 1000; i++ {
+		s.Add("k", time.Minute)
+		s.Remove("k")
+	}
+	if n := s.expires.Len(); n > 2*10+2 {
+		t.Errorf("heap len = %d after removes", n)
+	}
+}
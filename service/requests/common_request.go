@@ -4,6 +4,7 @@ package requests
 type CommonRequest struct {
 	Domain     string
 	ApiName    string
+	RequestId  string // 请求 ID 用于日志追踪
 	BizContent map[string]interface{}
 }
 
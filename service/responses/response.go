@@ -16,6 +16,8 @@ package responses
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"strconv"
 	"strings"
 
@@ -23,10 +25,31 @@ import (
 	"github.com/shopspring/decimal"
 
 	"github.com/lecex/vipspt/service/config"
+	"github.com/lecex/vipspt/service/logger"
 	"github.com/lecex/vipspt/service/requests"
 	"github.com/lecex/vipspt/service/util"
 )
 
+// ErrVerifySign 返回数据签名验证失败 数据可能被伪造或篡改
+var ErrVerifySign = errors.New("vipspt sSignature verify failed")
+
+// orderNotExistMsgs 网关订单不存在的返回信息
+var orderNotExistMsgs = []string{"订单不存在", "交易不存在", "原交易不存在", "订单号不存在"}
+
+// OrderNotExist 查询结果为订单不存在 仅此时可确认网关未受理原请求
+func OrderNotExist(content map[string]interface{}) bool {
+	if util.InterfaceToString(content["ret"]) == "0" {
+		return false
+	}
+	msg := util.InterfaceToString(content["msg"])
+	for _, v := range orderNotExistMsgs {
+		if strings.Contains(msg, v) {
+			return true
+		}
+	}
+	return false
+}
+
 const (
 	CLOSED     = "CLOSED"     // -1 订单关闭
 	USERPAYING = "USERPAYING" // 0	订单支付中
@@ -69,9 +92,61 @@ func (res *CommonResponse) GetVerifySignDataMap() (m mxj.Map, err error) {
 	if err != nil {
 		return r, err
 	}
+	if err = res.VerifySign(r); err != nil {
+		return nil, err
+	}
 	return res.GetSignDataMap()
 }
 
+// VerifySign 使用平台公钥验证 data 中的 sSignature 签名 列表数据逐条验证
+func (res *CommonResponse) VerifySign(content mxj.Map) (err error) {
+	var items []interface{}
+	switch {
+	case res.Request.ApiName == "pay.notify":
+		items = []interface{}{dataMap(content)}
+	case util.InterfaceToString(content["ret"]) != "0":
+		return nil // 失败返回无 data 签名
+	default:
+		// 成功返回必须包含已签名的 data 列表接口为数组 其他接口为对象
+		switch v := content["data"].(type) {
+		case map[string]interface{}:
+			if res.Request.ApiName == "pay.list" {
+				return fmt.Errorf("%w: data 不是列表", ErrVerifySign)
+			}
+			items = []interface{}{v}
+		case []interface{}:
+			if res.Request.ApiName != "pay.list" {
+				return fmt.Errorf("%w: data 不是对象", ErrVerifySign)
+			}
+			items = v
+		default:
+			return fmt.Errorf("%w: data 不存在或格式错误", ErrVerifySign)
+		}
+	}
+	keys := res.Config.VerifyKeys()
+	if len(items) > 0 && keys[0] == "" {
+		return fmt.Errorf("%w: verify key is empty", ErrVerifySign)
+	}
+	for _, item := range items {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%w: data 格式错误", ErrVerifySign)
+		}
+		index, err := util.VerifyDataSignKeys(m, res.Config.VerifySignType, keys...)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrVerifySign, err)
+		}
+		if index > 0 {
+			logger.Default.Warn(res.Request.RequestId, "Vipspt[VerifySign]secondary key used", logger.Fields{
+				"api":         res.Request.ApiName,
+				"merchant_id": res.Config.MerchantId,
+				"sign_type":   res.Config.VerifySignType,
+			})
+		}
+	}
+	return nil
+}
+
 // GetSignData 获取 SignData 数据
 func (res *CommonResponse) GetSignData() string {
 	indexStart := strings.Index(res.json, `response":`)
@@ -130,7 +205,36 @@ func (res *CommonResponse) GetSignDataMap() (mxj.Map, error) {
 	if res.Request.ApiName == "pay.refundQuery" {
 		data = res.handerVipsptTradeRefundQuery(content)
 	}
+	if res.Request.ApiName == "pay.jsapi" {
+		data = res.handerVipsptTradeJsApi(content)
+	}
+	if res.Request.ApiName == "pay.qrcode" {
+		data = res.handerVipsptTradeQRCode(content)
+	}
+	if res.Request.ApiName == "pay.close" {
+		data = res.handerVipsptTradeClose(content)
+	}
+	if res.Request.ApiName == "pay.reverse" {
+		data = res.handerVipsptTradeReverse(content)
+	}
+	if res.Request.ApiName == "pay.openid" {
+		data = res.handerVipsptTradeOpenId(content)
+	}
+	if res.Request.ApiName == "pay.facepayInfo" {
+		data = res.handerVipsptTradeFacePayInfo(content)
+	}
+	if res.Request.ApiName == "pay.notify" {
+		data = res.handerVipsptTradeNotify(content)
+	}
+	if res.Request.ApiName == "pay.list" {
+		data = res.handerVipsptTradeList(content)
+	}
 
+	// 实际支付方式
+	if v, ok := dataMap(content)["pay_way"]; ok {
+		data["pay_way"] = v
+		data["method"] = config.PayMethod(util.InterfaceToString(v))
+	}
 	data["channel"] = "vipspt" //渠道
 	data["content"] = content
 	return data, err
@@ -156,7 +260,7 @@ func (res *CommonResponse) handerVipsptTradePay(content mxj.Map) mxj.Map {
 		data["return_msg"] = v
 	}
 	if util.InterfaceToString(content["ret"]) == "0" {
-		contentData := content["data"].(map[string]interface{})
+		contentData, _ := content["data"].(map[string]interface{})
 		data["return_code"] = SUCCESS
 		switch contentData["status"] {
 		case "0":
@@ -218,7 +322,7 @@ func (res *CommonResponse) handerVipsptTradeQuery(content mxj.Map) mxj.Map {
 		data["return_msg"] = v
 	}
 	if util.InterfaceToString(content["ret"]) == "0" {
-		contentData := content["data"].(map[string]interface{})
+		contentData, _ := content["data"].(map[string]interface{})
 		data["return_code"] = SUCCESS
 		if v, ok := contentData["payMsg"]; ok {
 			data["return_msg"] = v
@@ -280,7 +384,7 @@ func (res *CommonResponse) handerVipsptTradeRefund(content mxj.Map) mxj.Map {
 		data["return_msg"] = v
 	}
 	if util.InterfaceToString(content["ret"]) == "0" {
-		contentData := content["data"].(map[string]interface{})
+		contentData, _ := content["data"].(map[string]interface{})
 		data["return_code"] = SUCCESS
 		switch contentData["status"] {
 		case "0":
@@ -334,7 +438,7 @@ func (res *CommonResponse) handerVipsptTradeRefundQuery(content mxj.Map) mxj.Map
 		data["return_msg"] = v
 	}
 	if util.InterfaceToString(content["ret"]) == "0" {
-		contentData := content["data"].(map[string]interface{})
+		contentData, _ := content["data"].(map[string]interface{})
 		data["return_code"] = SUCCESS
 		if v, ok := contentData["payMsg"]; ok {
 			data["return_msg"] = v
@@ -367,3 +471,262 @@ func (res *CommonResponse) handerVipsptTradeRefundQuery(content mxj.Map) mxj.Map
 	}
 	return data
 }
+
+// {"ret":0,"msg":"操作成功","data":{"third_order_id":"20221012101530726315",
+// "out_order_id":"151345706127381181883","amount":"0.01","status":"0",
+// "merchant_id":"307989950941205","enterpriseReg":"NKOt4Ygx","pay_way":"WXZF",
+// "jspay_info":{"appId":"wx26e296a18096b757","timeStamp":"1665541530","nonceStr":"...",
+// "package":"prepay_id=...","signType":"RSA","paySign":"..."},
+// "sSignature":"..."}}
+// 支付宝 "jspay_info":{"tradeNO":"2022101222001476811430088888"} jspay_info 也可能是 JSON 字符串
+// handerVipsptTradeJsApi
+func (res *CommonResponse) handerVipsptTradeJsApi(content mxj.Map) mxj.Map {
+	data := mxj.New()
+	data["status"] = "" // 状态
+	data["return_msg"] = ""
+	if v, ok := content["msg"]; ok {
+		data["return_msg"] = v
+	}
+	if util.InterfaceToString(content["ret"]) == "0" {
+		contentData, _ := content["data"].(map[string]interface{})
+		data["return_code"] = SUCCESS
+		data["status"] = USERPAYING
+		data["bank_trade_no"] = contentData["third_order_id"] // 银行订单
+		data["out_trade_no"] = contentData["out_order_id"]
+		// 唤起支付参数 微信 timeStamp nonceStr package paySign 支付宝 tradeNO
+		var payInfo map[string]interface{}
+		switch v := contentData["jspay_info"].(type) {
+		case string:
+			payInfo, _ = mxj.NewMapJson([]byte(v))
+		case map[string]interface{}:
+			payInfo = v
+		}
+		for _, k := range []string{"appId", "timeStamp", "nonceStr", "package", "signType", "paySign", "tradeNO"} {
+			if v, ok := payInfo[k]; ok {
+				data[k] = v
+			}
+		}
+	} else {
+		data["return_code"] = "FAIL"
+	}
+	return data
+}
+
+// {"ret":0,"msg":"操作成功","data":{"third_order_id":"20221012103011573201",
+// "out_order_id":"151345706127381181884","amount":"0.01","status":"0",
+// "merchant_id":"307989950941205","enterpriseReg":"NKOt4Ygx","pay_way":"ZFBZF",
+// "code_url":"https://qr.alipay.com/bax01234567890","sSignature":"..."}}
+// handerVipsptTradeQRCode
+func (res *CommonResponse) handerVipsptTradeQRCode(content mxj.Map) mxj.Map {
+	data := mxj.New()
+	data["status"] = "" // 状态
+	data["return_msg"] = ""
+	if v, ok := content["msg"]; ok {
+		data["return_msg"] = v
+	}
+	if util.InterfaceToString(content["ret"]) == "0" {
+		contentData, _ := content["data"].(map[string]interface{})
+		data["return_code"] = SUCCESS
+		data["status"] = USERPAYING
+		data["bank_trade_no"] = contentData["third_order_id"] // 银行订单
+		data["out_trade_no"] = contentData["out_order_id"]
+		data["qr_code"] = contentData["code_url"] // 二维码内容
+	} else {
+		data["return_code"] = "FAIL"
+	}
+	return data
+}
+
+// {"ret":0,"msg":"操作成功","data":{"third_order_id":"20221012103011573201",
+// "out_order_id":"151345706127381181884","status":"6",
+// "merchant_id":"307989950941205","enterpriseReg":"NKOt4Ygx","sSignature":"..."}}
+// handerVipsptTradeClose
+func (res *CommonResponse) handerVipsptTradeClose(content mxj.Map) mxj.Map {
+	data := mxj.New()
+	data["status"] = "" // 状态
+	data["return_msg"] = ""
+	if v, ok := content["msg"]; ok {
+		data["return_msg"] = v
+	}
+	if util.InterfaceToString(content["ret"]) == "0" {
+		contentData, _ := content["data"].(map[string]interface{})
+		data["return_code"] = SUCCESS
+		data["status"] = CLOSED
+		data["bank_trade_no"] = contentData["third_order_id"] // 银行订单
+		data["out_trade_no"] = contentData["out_order_id"]
+	} else {
+		data["return_code"] = "FAIL"
+	}
+	return data
+}
+
+// {"ret":0,"msg":"操作成功","data":{"third_order_id":"20221011111351886981",
+// "out_order_id":"513457061273811891","status":"8","recall":"Y",
+// "merchant_id":"307989950941205","enterpriseReg":"NKOt4Ygx","sSignature":"..."}}
+// handerVipsptTradeReverse
+func (res *CommonResponse) handerVipsptTradeReverse(content mxj.Map) mxj.Map {
+	data := mxj.New()
+	data["status"] = "" // 状态
+	data["return_msg"] = ""
+	if v, ok := content["msg"]; ok {
+		data["return_msg"] = v
+	}
+	if util.InterfaceToString(content["ret"]) == "0" {
+		contentData, _ := content["data"].(map[string]interface{})
+		data["return_code"] = SUCCESS
+		data["status"] = CLOSED
+		// recall 为 Y 时需要重新调用撤销
+		if contentData["recall"] == "Y" {
+			data["status"] = WAITING
+		}
+		data["bank_trade_no"] = contentData["third_order_id"] // 银行订单
+		data["out_trade_no"] = contentData["out_order_id"]
+	} else {
+		data["return_code"] = "FAIL"
+	}
+	return data
+}
+
+// {"ret":0,"msg":"操作成功","data":{"merchant_id":"307989950941205","enterpriseReg":"NKOt4Ygx",
+// "pay_way":"WXZF","openid":"okCtS6IyyODgL6EyAI3HQLUEN-cs","buyer_id":"","sSignature":"..."}}
+// 支付宝 "pay_way":"ZFBZF","openid":"","buyer_id":"2088002104076813"
+// handerVipsptTradeOpenId
+func (res *CommonResponse) handerVipsptTradeOpenId(content mxj.Map) mxj.Map {
+	data := mxj.New()
+	data["return_msg"] = ""
+	if v, ok := content["msg"]; ok {
+		data["return_msg"] = v
+	}
+	if util.InterfaceToString(content["ret"]) == "0" {
+		contentData, _ := content["data"].(map[string]interface{})
+		data["return_code"] = SUCCESS
+		data["openid"] = contentData["openid"]
+		data["buyer_id"] = contentData["buyer_id"]
+		// 支付宝用户标识为 buyer_id
+		if util.InterfaceToString(data["openid"]) == "" {
+			data["openid"] = data["buyer_id"]
+		}
+	} else {
+		data["return_code"] = "FAIL"
+	}
+	return data
+}
+
+// {"ret":0,"msg":"操作成功","data":{"merchant_id":"307989950941205","enterpriseReg":"NKOt4Ygx",
+// "authinfo":"...","expires_in":"3600","appid":"wx2421b1c4370ec43b","mch_id":"1900000109",
+// "sub_appid":"","sub_mch_id":"1900000110","store_id":"1001","sSignature":"..."}}
+// handerVipsptTradeFacePayInfo
+func (res *CommonResponse) handerVipsptTradeFacePayInfo(content mxj.Map) mxj.Map {
+	data := mxj.New()
+	data["return_msg"] = ""
+	if v, ok := content["msg"]; ok {
+		data["return_msg"] = v
+	}
+	if util.InterfaceToString(content["ret"]) == "0" {
+		contentData, _ := content["data"].(map[string]interface{})
+		data["return_code"] = SUCCESS
+		data["authinfo"] = contentData["authinfo"]     // 刷脸调用凭证
+		data["expires_in"] = contentData["expires_in"] // 凭证有效时间(秒)
+		data["appid"] = contentData["appid"]
+		data["mch_id"] = contentData["mch_id"]
+		data["sub_appid"] = contentData["sub_appid"]
+		data["sub_mch_id"] = contentData["sub_mch_id"]
+		data["store_id"] = contentData["store_id"]
+	} else {
+		data["return_code"] = "FAIL"
+	}
+	return data
+}
+
+// dataMap 获取 data 数据 兼容异步通知的平铺数据
+func dataMap(content mxj.Map) map[string]interface{} {
+	if v, ok := content["data"].(map[string]interface{}); ok {
+		return v
+	}
+	return content
+}
+
+// {"third_order_id":"20221011160916675235","out_order_id":"513457061273811892",
+// "amount":"0.01","status":"2","merchant_id":"307989950941205","enterpriseReg":"NKOt4Ygx",
+// "dctime":"2022-10-11 16:09:16","pay_way":"WXZF","sSignature":"..."}
+// handerVipsptTradeNotify 与查询返回相同
+func (res *CommonResponse) handerVipsptTradeNotify(content mxj.Map) mxj.Map {
+	return res.handerVipsptTradeQuery(mxj.Map{
+		"ret":  "0",
+		"data": dataMap(content),
+	})
+}
+
+// {"ret":0,"msg":"操作成功","data":[{"third_order_id":"20221011111351886981",
+// "out_order_id":"513457061273811891","amount":"0.01","status":"2","pay_way":"WXZF",
+// "dctime":"2022-10-11 11:13:51.0","old_third_order_id":"","sSignature":"..."},
+// {"third_order_id":"20221011162901020790","out_order_id":"113457061273811892",
+// "amount":"-0.01","status":"2","pay_way":"WXZF","dctime":"2022-10-11 16:29:02.0",
+// "old_third_order_id":"20221011111351886981","sSignature":"..."}],"totalPage":"3"}
+// handerVipsptTradeList
+func (res *CommonResponse) handerVipsptTradeList(content mxj.Map) mxj.Map {
+	data := mxj.New()
+	data["return_msg"] = ""
+	if v, ok := content["msg"]; ok {
+		data["return_msg"] = v
+	}
+	if util.InterfaceToString(content["ret"]) == "0" {
+		data["return_code"] = SUCCESS
+		list := []interface{}{}
+		items, _ := content["data"].([]interface{})
+		for _, item := range items {
+			if contentData, ok := item.(map[string]interface{}); ok {
+				list = append(list, map[string]interface{}(res.handerVipsptTradeRecord(contentData)))
+			}
+		}
+		data["list"] = list
+		data["total_page"] = util.InterfaceToString(content["totalPage"])
+	} else {
+		data["return_code"] = "FAIL"
+	}
+	return data
+}
+
+// handerVipsptTradeRecord 交易流水 金额为负数时为退款
+func (res *CommonResponse) handerVipsptTradeRecord(contentData map[string]interface{}) mxj.Map {
+	data := mxj.New()
+	data["status"] = "" // 状态
+	switch contentData["status"] {
+	case "0":
+		data["status"] = USERPAYING
+	case "2":
+		data["status"] = SUCCESS
+	case "6":
+		data["status"] = CLOSED
+	case "7":
+		data["status"] = WAITING
+	case "8":
+		data["status"] = CLOSED
+	case "11":
+		data["status"] = WAITING
+	}
+	data["refund"] = false
+	// string 转 float64
+	if v, ok := contentData["amount"]; ok {
+		if v1, ok := v.(string); ok {
+			if v2, err := strconv.ParseFloat(v1, 64); err == nil {
+				total_amt := decimal.NewFromFloat(v2).Mul(decimal.NewFromFloat(float64(100))).IntPart()
+				data["total_fee"] = total_amt
+				data["refund"] = total_amt < 0
+			}
+		}
+	}
+	data["bank_trade_no"] = contentData["third_order_id"] // 银行订单
+	data["out_trade_no"] = contentData["out_order_id"]
+	data["original_bank_trade_no"] = contentData["old_third_order_id"] // 退款原订单
+	data["pay_way"] = contentData["pay_way"]
+	data["method"] = config.PayMethod(util.InterfaceToString(contentData["pay_way"]))
+	if v, ok := contentData["dctime"].(string); ok {
+		// 字符串替换-为空
+		v = strings.Split(v, ".")[0]
+		v = strings.Replace(v, "-", "", -1)
+		v = strings.Replace(v, " ", "", -1)
+		data["time_end"] = strings.Replace(v, ":", "", -1)
+	}
+	return data
+}
@@ -0,0 +1,243 @@
+package responses
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/lecex/vipspt/service/config"
+	"github.com/lecex/vipspt/service/requests"
+	"github.com/lecex/vipspt/service/util"
+)
+
+// testKey 生成平台密钥 返回 PEM 公钥
+func testKey(t *testing.T) (*rsa.PrivateKey, string) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+// signData 按平台规则为 data 添加 sSignature
+func signData(t *testing.T, key *rsa.PrivateKey, data map[string]interface{}) map[string]interface{} {
+	sum := sha1.Sum([]byte(util.EncodeSignParams(data)))
+	sign, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA1, sum[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	data["sSignature"] = base64.StdEncoding.EncodeToString(sign)
+	return data
+}
+
+func newResponse(t *testing.T, publicKey, apiName string, content interface{}) *CommonResponse {
+	body, err := json.Marshal(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := requests.NewCommonRequest()
+	request.ApiName = apiName
+	res := NewCommonResponse(&config.Config{PublicKey: publicKey}, request)
+	res.SetHttpContent(body, "string")
+	return res
+}
+
+func TestVerifySignRequiresData(t *testing.T) {
+	key, publicKey := testKey(t)
+	tests := []struct {
+		name    string
+		apiName string
+		body    string
+	}{
+		{"missing data", "pay.pay", `{"ret":0}`},
+		{"string data", "pay.query", `{"ret":0,"data":"x"}`},
+		{"list for object api", "pay.query", `{"ret":0,"data":[]}`},
+		{"object for list api", "pay.list", `{"ret":0,"data":{}}`},
+		{"unsigned data", "pay.pay", `{"ret":0,"data":{"status":"2"}}`},
+	}
+	for _, tt := range tests {
+		request := requests.NewCommonRequest()
+		request.ApiName = tt.apiName
+		res := NewCommonResponse(&config.Config{PublicKey: publicKey}, request)
+		res.SetHttpContent([]byte(tt.body), "string")
+		if _, err := res.GetVerifySignDataMap(); !errors.Is(err, ErrVerifySign) {
+			t.Errorf("%s: err = %v, want ErrVerifySign", tt.name, err)
+		}
+	}
+
+	data := signData(t, key, map[string]interface{}{"out_order_id": "1", "status": "2", "amount": "0.01"})
+	m, err := newResponse(t, publicKey, "pay.pay", map[string]interface{}{"ret": 0, "data": data}).GetVerifySignDataMap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m["status"] != SUCCESS || m["total_fee"] != int64(1) {
+		t.Errorf("pay = %v", m)
+	}
+
+	data["amount"] = "100.00"
+	if _, err := newResponse(t, publicKey, "pay.pay", map[string]interface{}{"ret": 0, "data": data}).GetVerifySignDataMap(); !errors.Is(err, ErrVerifySign) {
+		t.Errorf("tampered: err = %v, want ErrVerifySign", err)
+	}
+}
+
+func TestVerifySignPlatformKey(t *testing.T) {
+	key, publicKey := testKey(t)
+	data := signData(t, key, map[string]interface{}{"out_order_id": "1", "status": "2"})
+	body, _ := json.Marshal(map[string]interface{}{"ret": 0, "data": data})
+	// 请求签名类型不影响返回数据验签 均使用平台公钥
+	for _, signType := range []string{"", "SHA256", "MD5", "SM3", "RSA2"} {
+		request := requests.NewCommonRequest()
+		request.ApiName = "pay.query"
+		res := NewCommonResponse(&config.Config{SignType: signType, SecretKey: "secret", PublicKey: publicKey}, request)
+		res.SetHttpContent(body, "string")
+		if _, err := res.GetVerifySignDataMap(); err != nil {
+			t.Errorf("SignType %q: %v", signType, err)
+		}
+	}
+
+	// 商户密钥摘要签名不能通过验签
+	digest := map[string]interface{}{"out_order_id": "1", "status": "2"}
+	sign, err := util.Sign(digest, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest["sSignature"] = sign
+	body, _ = json.Marshal(map[string]interface{}{"ret": 0, "data": digest})
+	request := requests.NewCommonRequest()
+	request.ApiName = "pay.query"
+	res := NewCommonResponse(&config.Config{SignType: "SHA256", SecretKey: "secret", PublicKey: publicKey}, request)
+	res.SetHttpContent(body, "string")
+	if _, err := res.GetVerifySignDataMap(); !errors.Is(err, ErrVerifySign) {
+		t.Errorf("digest signature: err = %v, want ErrVerifySign", err)
+	}
+}
+
+func TestVerifySignKeyRotation(t *testing.T) {
+	oldKey, oldPublicKey := testKey(t)
+	_, newPublicKey := testKey(t)
+	data := signData(t, oldKey, map[string]interface{}{"out_order_id": "1", "status": "2"})
+	body, _ := json.Marshal(map[string]interface{}{"ret": 0, "data": data})
+	for _, tt := range []struct {
+		until time.Time
+		ok    bool
+	}{
+		{time.Now().Add(time.Hour), true},
+		{time.Now().Add(-time.Hour), false},
+		{time.Time{}, false},
+	} {
+		request := requests.NewCommonRequest()
+		request.ApiName = "pay.query"
+		res := NewCommonResponse(&config.Config{
+			PublicKey:          newPublicKey,
+			PublicKeySecondary: oldPublicKey,
+			KeyOverlapUntil:    tt.until,
+		}, request)
+		res.SetHttpContent(body, "string")
+		_, err := res.GetVerifySignDataMap()
+		if (err == nil) != tt.ok {
+			t.Errorf("until %s: err = %v, want ok %v", tt.until, err, tt.ok)
+		}
+	}
+}
+
+func TestMappers(t *testing.T) {
+	key, publicKey := testKey(t)
+	success := func(data map[string]interface{}) map[string]interface{} {
+		return map[string]interface{}{"ret": 0, "msg": "操作成功", "data": signData(t, key, data)}
+	}
+	tests := []struct {
+		name    string
+		apiName string
+		content map[string]interface{}
+		want    map[string]interface{}
+	}{
+		{"jsapi object jspay_info", "pay.jsapi", success(map[string]interface{}{
+			"third_order_id": "2001", "out_order_id": "1001", "status": "0", "pay_way": "WXZF",
+			"jspay_info": map[string]interface{}{"appId": "wx1", "timeStamp": "1665541530", "nonceStr": "n", "package": "prepay_id=1", "signType": "RSA", "paySign": "s"},
+		}), map[string]interface{}{
+			"return_code": SUCCESS, "status": USERPAYING, "bank_trade_no": "2001", "out_trade_no": "1001", "method": "wechat",
+			"appId": "wx1", "timeStamp": "1665541530", "nonceStr": "n", "package": "prepay_id=1", "signType": "RSA", "paySign": "s",
+		}},
+		{"jsapi string jspay_info", "pay.jsapi", success(map[string]interface{}{
+			"third_order_id": "2001", "out_order_id": "1001", "status": "0", "pay_way": "ZFBZF",
+			"jspay_info": `{"tradeNO":"2022101222001476811430088888"}`,
+		}), map[string]interface{}{
+			"return_code": SUCCESS, "status": USERPAYING, "method": "alipay", "tradeNO": "2022101222001476811430088888",
+		}},
+		{"jsapi failed", "pay.jsapi", map[string]interface{}{"ret": 1, "msg": "参数错误"}, map[string]interface{}{
+			"return_code": "FAIL", "status": "", "return_msg": "参数错误",
+		}},
+		{"qrcode", "pay.qrcode", success(map[string]interface{}{
+			"third_order_id": "2001", "out_order_id": "1001", "status": "0", "pay_way": "ZFBZF", "code_url": "https://qr.alipay.com/bax01",
+		}), map[string]interface{}{
+			"return_code": SUCCESS, "status": USERPAYING, "bank_trade_no": "2001", "out_trade_no": "1001", "qr_code": "https://qr.alipay.com/bax01",
+		}},
+		{"close", "pay.close", success(map[string]interface{}{
+			"third_order_id": "2001", "out_order_id": "1001", "status": "6",
+		}), map[string]interface{}{
+			"return_code": SUCCESS, "status": CLOSED, "bank_trade_no": "2001", "out_trade_no": "1001",
+		}},
+		{"close failed", "pay.close", map[string]interface{}{"ret": 1, "msg": "订单不存在"}, map[string]interface{}{
+			"return_code": "FAIL", "status": "",
+		}},
+		{"reverse", "pay.reverse", success(map[string]interface{}{
+			"third_order_id": "2001", "out_order_id": "1001", "status": "8",
+		}), map[string]interface{}{
+			"return_code": SUCCESS, "status": CLOSED, "bank_trade_no": "2001", "out_trade_no": "1001",
+		}},
+		{"reverse recall", "pay.reverse", success(map[string]interface{}{
+			"third_order_id": "2001", "out_order_id": "1001", "status": "8", "recall": "Y",
+		}), map[string]interface{}{
+			"return_code": SUCCESS, "status": WAITING,
+		}},
+		{"openid wechat", "pay.openid", success(map[string]interface{}{
+			"pay_way": "WXZF", "openid": "okCtS6IyyODgL6EyAI3HQLUEN-cs", "buyer_id": "",
+		}), map[string]interface{}{
+			"return_code": SUCCESS, "openid": "okCtS6IyyODgL6EyAI3HQLUEN-cs", "buyer_id": "",
+		}},
+		{"openid buyer_id fallback", "pay.openid", success(map[string]interface{}{
+			"pay_way": "ZFBZF", "openid": "", "buyer_id": "2088002104076813",
+		}), map[string]interface{}{
+			"return_code": SUCCESS, "openid": "2088002104076813", "buyer_id": "2088002104076813",
+		}},
+		{"face pay info", "pay.facepayInfo", success(map[string]interface{}{
+			"authinfo": "auth", "expires_in": "3600", "appid": "wx2421b1c4370ec43b", "mch_id": "1900000109",
+			"sub_appid": "", "sub_mch_id": "1900000110", "store_id": "1001",
+		}), map[string]interface{}{
+			"return_code": SUCCESS, "authinfo": "auth", "expires_in": "3600", "appid": "wx2421b1c4370ec43b",
+			"mch_id": "1900000109", "sub_appid": "", "sub_mch_id": "1900000110", "store_id": "1001",
+		}},
+		{"notify", "pay.notify", signData(t, key, map[string]interface{}{
+			"third_order_id": "2001", "out_order_id": "1001", "amount": "0.01", "status": "2",
+			"dctime": "2022-10-11 16:09:16", "pay_way": "WXZF",
+		}), map[string]interface{}{
+			"return_code": SUCCESS, "status": SUCCESS, "total_fee": int64(1), "bank_trade_no": "2001", "out_trade_no": "1001",
+			"time_end": "20221011160916", "method": "wechat", "channel": "vipspt",
+		}},
+	}
+	for _, tt := range tests {
+		data, err := newResponse(t, publicKey, tt.apiName, tt.content).GetVerifySignDataMap()
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		for k, want := range tt.want {
+			if got := data[k]; !reflect.DeepEqual(got, want) {
+				t.Errorf("%s: %s = %#v, want %#v", tt.name, k, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/lecex/vipspt/service/common"
+	"github.com/lecex/vipspt/service/config"
+	"github.com/lecex/vipspt/service/logger"
+	"github.com/lecex/vipspt/service/requests"
+	"github.com/lecex/vipspt/service/responses"
+	"github.com/lecex/vipspt/service/util"
+)
+
+// ErrUnknownOutcome 支付或退款结果未知 需稍后查询订单确认
+var ErrUnknownOutcome = errors.New("vipspt outcome unknown")
+
+// UnknownOutcomeError 请求失败且查询未能确认结果 errors.Is(err, ErrUnknownOutcome) 为 true
+type UnknownOutcomeError struct {
+	ApiName string
+	Err     error
+}
+
+func (e *UnknownOutcomeError) Error() string {
+	return fmt.Sprintf("%v: %s %v", ErrUnknownOutcome, e.ApiName, e.Err)
+}
+
+// Is 匹配 ErrUnknownOutcome
+func (e *UnknownOutcomeError) Is(target error) bool {
+	return target == ErrUnknownOutcome
+}
+
+// Unwrap 原始错误
+func (e *UnknownOutcomeError) Unwrap() error {
+	return e.Err
+}
+
+// idempotentApis 可安全重发的查询接口
+var idempotentApis = map[string]bool{
+	"pay.query":       true,
+	"pay.refundQuery": true,
+	"pay.list":        true,
+}
+
+// resolveApis 不可重发的接口 请求失败时按 out_order_id 查询确认结果
+var resolveApis = map[string]string{
+	"pay.pay":    "pay.query",
+	"pay.refund": "pay.refundQuery",
+}
+
+// retryPolicy 重试配置 零值使用默认值
+func (client *Client) retryPolicy() config.Retry {
+	retry := client.Config.Retry
+	if retry.MaxAttempts <= 0 {
+		retry.MaxAttempts = 3
+	}
+	if retry.BaseDelay <= 0 {
+		retry.BaseDelay = 200 * time.Millisecond
+	}
+	if retry.MaxDelay <= 0 {
+		retry.MaxDelay = 2 * time.Second
+	}
+	if retry.ResolveTimeout <= 0 {
+		retry.ResolveTimeout = 10 * time.Second
+	}
+	return retry
+}
+
+// backoff 第 attempt 次重试前等待时间 指数退避加随机抖动
+func backoff(retry config.Retry, attempt int) time.Duration {
+	d := retry.BaseDelay << uint(attempt-1)
+	if d <= 0 || d > retry.MaxDelay {
+		d = retry.MaxDelay
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// sleep 等待 ctx 取消时提前返回
+func sleep(ctx context.Context, d time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d):
+		return nil
+	}
+}
+
+// isNetworkError 网关请求失败 结果未知
+func isNetworkError(err error) bool {
+	var e *common.NetworkError
+	return errors.As(err, &e)
+}
+
+// doRetry 查询类接口 网关请求失败时重试
+func (client *Client) doRetry(ctx context.Context, request *requests.CommonRequest, response *responses.CommonResponse) (err error) {
+	retry := client.retryPolicy()
+	for attempt := 1; ; attempt++ {
+		err = client.do(ctx, request, response)
+		if err == nil || !isNetworkError(err) || attempt >= retry.MaxAttempts {
+			return err
+		}
+		delay := backoff(retry, attempt)
+		logger.Default.Warn(request.RequestId, "Vipspt[retry]", logger.Fields{
+			"api":     request.ApiName,
+			"attempt": attempt,
+			"delay":   delay.String(),
+			"error":   err,
+		})
+		if e := sleep(ctx, delay); e != nil {
+			return err
+		}
+	}
+}
+
+// doResolve 支付及退款不重发 网关请求失败时按 out_order_id 查询确认结果
+// 查询到订单时返回查询结果 网关明确订单不存在时返回失败结果 其他情况返回 *UnknownOutcomeError
+func (client *Client) doResolve(ctx context.Context, request *requests.CommonRequest, response *responses.CommonResponse) (err error) {
+	err = client.do(ctx, request, response)
+	if err == nil || !isNetworkError(err) {
+		return err
+	}
+	retry := client.retryPolicy()
+	// 调用方已超时或取消时 使用独立超时完成确认
+	if ctx.Err() != nil {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(context.Background(), retry.ResolveTimeout)
+		defer cancel()
+	}
+	query := requests.NewCommonRequest()
+	query.ApiName = resolveApis[request.ApiName]
+	query.RequestId = request.RequestId
+	query.BizContent = map[string]interface{}{
+		"merchant_id":   request.BizContent["merchant_id"],
+		"enterpriseReg": request.BizContent["enterpriseReg"],
+		"out_order_id":  request.BizContent["out_order_id"],
+	}
+	var notFound *responses.CommonResponse
+	for attempt := 1; attempt <= retry.MaxAttempts; attempt++ {
+		// 网关可能仍在处理原请求 查询前等待
+		if e := sleep(ctx, backoff(retry, attempt)); e != nil {
+			break
+		}
+		res := responses.NewCommonResponse(client.Config, query)
+		e := client.do(ctx, query, res)
+		var content map[string]interface{}
+		if e == nil {
+			content, e = res.GetHttpContentMap()
+		}
+		logger.Default.Warn(request.RequestId, "Vipspt[resolve]", logger.Fields{
+			"api":     request.ApiName,
+			"query":   query.ApiName,
+			"attempt": attempt,
+			"cause":   err,
+			"error":   e,
+			"ret":     content["ret"],
+			"msg":     content["msg"],
+		})
+		if e != nil {
+			continue
+		}
+		if util.InterfaceToString(content["ret"]) == "0" {
+			response.SetHttpContent([]byte(res.GetHttpContentJson()), "string")
+			return nil
+		}
+		// 仅网关明确订单不存在时视为未受理 系统繁忙等错误结果仍未知
+		if responses.OrderNotExist(content) {
+			notFound = res
+			// 原请求可能仍在途 继续查询直至次数用尽
+			continue
+		}
+		notFound = nil
+	}
+	if notFound != nil {
+		response.SetHttpContent([]byte(notFound.GetHttpContentJson()), "string")
+		return nil
+	}
+	return &UnknownOutcomeError{ApiName: request.ApiName, Err: err}
+}
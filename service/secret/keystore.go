@@ -0,0 +1,132 @@
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// Keystore 本地加密密钥库
+// 文件内容为 {"name":"base64(nonce+密文)"} 使用主密钥 AES-256-GCM 加密
+type Keystore struct {
+	path  string
+	aead  cipher.AEAD
+	ttl   time.Duration
+	mu    sync.Mutex
+	cache map[string]cacheItem
+}
+
+type cacheItem struct {
+	secret string
+	expire time.Time
+}
+
+// NewKeystore 创建密钥库 masterKey 为 32 字节主密钥 ttl 为解密结果缓存时间
+func NewKeystore(path string, masterKey []byte, ttl time.Duration) (*Keystore, error) {
+	if len(masterKey) != 32 {
+		return nil, fmt.Errorf("keystore master key must be 32 bytes")
+	}
+	block, err := aes.NewCipher(masterKey)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Keystore{
+		path:  path,
+		aead:  aead,
+		ttl:   ttl,
+		cache: map[string]cacheItem{},
+	}, nil
+}
+
+// Secret 获取并解密密钥
+func (k *Keystore) Secret(name string) (secret string, err error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if item, ok := k.cache[name]; ok && time.Now().Before(item.expire) {
+		return item.secret, nil
+	}
+	entries, err := k.load()
+	if err != nil {
+		return "", err
+	}
+	v, ok := entries[name]
+	if !ok {
+		return "", fmt.Errorf("keystore secret %s not found", name)
+	}
+	secret, err = k.open(name, v)
+	if err != nil {
+		return "", fmt.Errorf("keystore secret %s decrypt error=%v", name, err)
+	}
+	k.cache[name] = cacheItem{secret: secret, expire: time.Now().Add(k.ttl)}
+	return secret, nil
+}
+
+// Put 加密并写入密钥
+func (k *Keystore) Put(name string, secret string) (err error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	entries, err := k.load()
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, k.aead.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+	entries[name] = base64.StdEncoding.EncodeToString(k.aead.Seal(nonce, nonce, []byte(secret), []byte(name)))
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := k.path + ".tmp"
+	if err = ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, k.path); err != nil {
+		return err
+	}
+	delete(k.cache, name)
+	return nil
+}
+
+// load 读取密钥库文件
+func (k *Keystore) load() (entries map[string]string, err error) {
+	entries = map[string]string{}
+	data, err := ioutil.ReadFile(k.path)
+	if os.IsNotExist(err) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read keystore path=%s, error=%v", k.path, err)
+	}
+	if err = json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("keystore path=%s format error=%v", k.path, err)
+	}
+	return entries, nil
+}
+
+// open 解密 密钥名作为附加数据 防止密文被替换到其他名称
+func (k *Keystore) open(name string, v string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(v)
+	if err != nil {
+		return "", err
+	}
+	if len(data) < k.aead.NonceSize() {
+		return "", fmt.Errorf("ciphertext too short")
+	}
+	nonce, ciphertext := data[:k.aead.NonceSize()], data[k.aead.NonceSize():]
+	b, err := k.aead.Open(nil, nonce, ciphertext, []byte(name))
+	return string(b), err
+}
@@ -0,0 +1,69 @@
+package secret
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/lecex/vipspt/service/util"
+)
+
+// Provider 密钥提供者 根据密钥引用解析密钥
+type Provider interface {
+	Secret(ref string) (secret string, err error)
+}
+
+// ErrReference 密钥引用不在允许范围内
+var ErrReference = errors.New("vipspt secret reference not allowed")
+
+// Resolver 按前缀解析密钥引用
+// env:NAME 环境变量, file:path 文件, keystore:name 加密密钥库, 无前缀时为明文密钥
+// 引用来自请求 env: 仅允许 EnvPrefix 开头的变量 file: 仅允许 FileDir 目录内的文件 未配置时禁用
+type Resolver struct {
+	Keystore  *Keystore
+	EnvPrefix string // 允许的环境变量前缀
+	FileDir   string // 允许的密钥文件目录
+}
+
+// NewResolver 创建密钥解析
+func NewResolver(keystore *Keystore, envPrefix string, fileDir string) *Resolver {
+	return &Resolver{
+		Keystore:  keystore,
+		EnvPrefix: envPrefix,
+		FileDir:   fileDir,
+	}
+}
+
+// Secret 解析密钥
+func (r *Resolver) Secret(ref string) (secret string, err error) {
+	switch {
+	case strings.HasPrefix(ref, "env:"):
+		name := strings.TrimPrefix(ref, "env:")
+		if r.EnvPrefix == "" || !strings.HasPrefix(name, r.EnvPrefix) {
+			return "", fmt.Errorf("%w: %s", ErrReference, ref)
+		}
+		secret = os.Getenv(name)
+		if secret == "" {
+			return "", fmt.Errorf("secret %s is empty", ref)
+		}
+		return secret, nil
+	case strings.HasPrefix(ref, "file:"):
+		path, err := util.AllowedPath(r.FileDir, strings.TrimPrefix(ref, "file:"))
+		if err != nil {
+			return "", fmt.Errorf("%w: %s", ErrReference, ref)
+		}
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("unable to read secret %s, error=%v", ref, err)
+		}
+		return strings.TrimSpace(string(b)), nil
+	case strings.HasPrefix(ref, "keystore:"):
+		if r.Keystore == nil {
+			return "", fmt.Errorf("secret %s keystore is not configured", ref)
+		}
+		return r.Keystore.Secret(strings.TrimPrefix(ref, "keystore:"))
+	}
+	return ref, nil
+}
@@ -0,0 +1,113 @@
+package secret
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "vipspt-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestKeystoreRoundTrip(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "keystore.json")
+	masterKey := []byte(strings.Repeat("k", 32))
+	ks, err := NewKeystore(path, masterKey, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.Put("merchant", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadFile(path)
+	if strings.Contains(string(data), "secret\"") {
+		t.Errorf("keystore stores plaintext: %s", data)
+	}
+
+	// 新实例从文件读取并解密
+	ks, _ = NewKeystore(path, masterKey, time.Minute)
+	if got, err := ks.Secret("merchant"); err != nil || got != "secret" {
+		t.Errorf("Secret = %q, %v", got, err)
+	}
+	wrong, _ := NewKeystore(path, []byte(strings.Repeat("x", 32)), time.Minute)
+	if _, err := wrong.Secret("merchant"); err == nil {
+		t.Error("wrong master key decrypted secret")
+	}
+
+	// 密文移动到其他名称时无法解密
+	entries := map[string]string{}
+	json.Unmarshal(data, &entries)
+	entries["other"] = entries["merchant"]
+	data, _ = json.Marshal(entries)
+	ioutil.WriteFile(path, data, 0600)
+	ks, _ = NewKeystore(path, masterKey, time.Minute)
+	if _, err := ks.Secret("other"); err == nil {
+		t.Error("moved ciphertext decrypted under another name")
+	}
+	if _, err := NewKeystore(path, []byte("short"), time.Minute); err == nil {
+		t.Error("short master key accepted")
+	}
+}
+
+func TestResolverReferences(t *testing.T) {
+	root := tempDir(t)
+	defer os.RemoveAll(root)
+	dir := filepath.Join(root, "secrets")
+	os.Mkdir(dir, 0700)
+	ioutil.WriteFile(filepath.Join(dir, "merchant"), []byte("file-secret\n"), 0600)
+	ioutil.WriteFile(filepath.Join(root, "outside"), []byte("outside"), 0600)
+	os.Setenv("VIPSPT_SECRET_MERCHANT", "env-secret")
+	os.Setenv("VIPSPT_OTHER", "other")
+	defer os.Unsetenv("VIPSPT_SECRET_MERCHANT")
+	defer os.Unsetenv("VIPSPT_OTHER")
+
+	r := NewResolver(nil, "VIPSPT_SECRET_", dir)
+	allowed := map[string]string{
+		"plain":                                  "plain",
+		"env:VIPSPT_SECRET_MERCHANT":             "env-secret",
+		"file:merchant":                          "file-secret",
+		"file:" + filepath.Join(dir, "merchant"): "file-secret",
+	}
+	for ref, want := range allowed {
+		if got, err := r.Secret(ref); err != nil || got != want {
+			t.Errorf("%s = %q, %v, want %q", ref, got, err, want)
+		}
+	}
+
+	rejected := []string{
+		"env:VIPSPT_OTHER",
+		"env:PAY_VIPSPT_MASTER_KEY",
+		"file:../outside",
+		"file:" + filepath.Join(root, "outside"),
+		"file:/etc/passwd",
+		"file:.",
+	}
+	for _, ref := range rejected {
+		if _, err := r.Secret(ref); !errors.Is(err, ErrReference) {
+			t.Errorf("%s: err = %v, want ErrReference", ref, err)
+		}
+	}
+
+	// 未配置前缀及目录时禁用 env: file:
+	r = NewResolver(nil, "", "")
+	for _, ref := range []string{"env:VIPSPT_SECRET_MERCHANT", "file:" + filepath.Join(dir, "merchant")} {
+		if _, err := r.Secret(ref); !errors.Is(err, ErrReference) {
+			t.Errorf("disabled %s: err = %v, want ErrReference", ref, err)
+		}
+	}
+	if _, err := r.Secret("keystore:merchant"); err == nil {
+		t.Error("keystore reference resolved without keystore")
+	}
+}
@@ -0,0 +1,44 @@
+package util
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// authCodeMethods 付款码规则 前缀及长度
+var authCodeMethods = []struct {
+	method string
+	rule   *regexp.Regexp
+}{
+	{"wechat", regexp.MustCompile(`^1[0-5]\d{16}$`)},         // 微信 10-15 开头 18 位
+	{"alipay", regexp.MustCompile(`^(2[5-9]|30)\d{14,22}$`)}, // 支付宝 25-30 开头 16-24 位
+	{"unionpay", regexp.MustCompile(`^62\d{17}$`)},           // 银联云闪付 62 开头 19 位
+	{"dcep", regexp.MustCompile(`^01\d{17}$`)},               // 数字人民币 01 开头 19 位
+}
+
+// AuthCodeMethod 根据付款码识别支付方式
+func AuthCodeMethod(authCode string) (method string, err error) {
+	for _, m := range authCodeMethods {
+		if m.rule.MatchString(authCode) {
+			return m.method, nil
+		}
+	}
+	return "", fmt.Errorf("付款码无法识别:%s", MaskAuthCode(authCode))
+}
+
+// CheckAuthCode 校验付款码格式 与 AuthCodeMethod 规则一致
+func CheckAuthCode(authCode string) error {
+	if _, err := AuthCodeMethod(authCode); err != nil {
+		return fmt.Errorf("付款码格式错误:%s", MaskAuthCode(authCode))
+	}
+	return nil
+}
+
+// MaskAuthCode 付款码脱敏 保留前 2 位及后 4 位
+func MaskAuthCode(authCode string) string {
+	if len(authCode) <= 6 {
+		return "****"
+	}
+	return authCode[:2] + strings.Repeat("*", len(authCode)-6) + authCode[len(authCode)-4:]
+}
@@ -0,0 +1,64 @@
+package util
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAuthCodeMethod(t *testing.T) {
+	tests := []struct {
+		authCode string
+		method   string
+	}{
+		// 微信 10-15 开头 18 位
+		{"101234567890123456", "wechat"},
+		{"134567890123456789", "wechat"},
+		{"151234567890123456", "wechat"},
+		{"161234567890123456", ""},
+		{"171234567890123456", ""},
+		{"13456789012345678", ""},
+		{"1345678901234567890", ""},
+		// 支付宝 25-30 开头 16-24 位
+		{"2512345678901234", "alipay"},
+		{"281234567890123456", "alipay"},
+		{"301234567890123456789012", "alipay"},
+		{"251234567890123", ""},
+		{"3012345678901234567890123", ""},
+		{"241234567890123456", ""},
+		{"311234567890123456", ""},
+		// 银联云闪付 62 开头 19 位
+		{"6212345678901234567", "unionpay"},
+		{"621234567890123456", ""},
+		// 数字人民币 01 开头 19 位
+		{"0112345678901234567", "dcep"},
+		{"011234567890123456", ""},
+		{"", ""},
+		{"13456789012345678a", ""},
+	}
+	for _, tt := range tests {
+		method, err := AuthCodeMethod(tt.authCode)
+		if method != tt.method || (err == nil) != (tt.method != "") {
+			t.Errorf("AuthCodeMethod(%q) = %q, %v, want %q", tt.authCode, method, err, tt.method)
+		}
+		// CheckAuthCode 与 AuthCodeMethod 一致
+		if err := CheckAuthCode(tt.authCode); (err == nil) != (tt.method != "") {
+			t.Errorf("CheckAuthCode(%q) = %v", tt.authCode, err)
+		}
+		if err != nil && len(tt.authCode) > 6 && strings.Contains(err.Error(), tt.authCode) {
+			t.Errorf("error contains auth code: %v", err)
+		}
+	}
+}
+
+func TestMaskAuthCode(t *testing.T) {
+	for v, want := range map[string]string{
+		"":                   "****",
+		"123456":             "****",
+		"1234567":            "12*4567",
+		"171234567890123456": "17************3456",
+	} {
+		if got := MaskAuthCode(v); got != want {
+			t.Errorf("MaskAuthCode(%q) = %q, want %q", v, got, want)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package util
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// 签名串规范
+// 1. 参数按 key 字节序升序排列 sign 不参与签名 格式 key1=value1&key2=value2
+// 2. nil 及空字符串为空值 skipEmpty 时不参与签名 否则为 key=
+// 3. 字符串原样 bool 为 true/false 整数为十进制 浮点数为不含指数的最短表示 decimal 为 String()
+// 4. 嵌套对象及数组为 key 升序、不转义 HTML 字符的紧凑 JSON 与请求报文一致
+
+// encodeSignParams 生成签名串 参数为空时返回空字符串
+func encodeSignParams(params map[string]interface{}, skipEmpty bool) string {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		if k == "sign" {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		v := params[k]
+		if skipEmpty && isEmptyValue(v) {
+			continue
+		}
+		parts = append(parts, k+"="+canonicalString(v))
+	}
+	return strings.Join(parts, "&")
+}
+
+// isEmptyValue 空值
+func isEmptyValue(v interface{}) bool {
+	switch val := v.(type) {
+	case nil:
+		return true
+	case string:
+		return val == ""
+	}
+	return false
+}
+
+// canonicalString 转换为签名字符串
+func canonicalString(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case bool:
+		return strconv.FormatBool(val)
+	case int:
+		return strconv.FormatInt(int64(val), 10)
+	case int8:
+		return strconv.FormatInt(int64(val), 10)
+	case int16:
+		return strconv.FormatInt(int64(val), 10)
+	case int32:
+		return strconv.FormatInt(int64(val), 10)
+	case int64:
+		return strconv.FormatInt(val, 10)
+	case uint:
+		return strconv.FormatUint(uint64(val), 10)
+	case uint8:
+		return strconv.FormatUint(uint64(val), 10)
+	case uint16:
+		return strconv.FormatUint(uint64(val), 10)
+	case uint32:
+		return strconv.FormatUint(uint64(val), 10)
+	case uint64:
+		return strconv.FormatUint(val, 10)
+	case float32:
+		return strconv.FormatFloat(float64(val), 'f', -1, 32)
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	case json.Number:
+		return val.String()
+	case decimal.Decimal:
+		return val.String()
+	case []byte:
+		return string(val)
+	}
+	b, err := canonicalJSON(v)
+	if err != nil {
+		return ""
+	}
+	// 自定义类型序列化为 JSON 字符串时取原值
+	var str string
+	if json.Unmarshal(b, &str) == nil {
+		return str
+	}
+	return string(b)
+}
+
+// canonicalJSON 紧凑 JSON map key 升序 不转义 HTML 字符
+func canonicalJSON(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
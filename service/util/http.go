@@ -2,6 +2,7 @@ package util
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"encoding/pem"
@@ -9,7 +10,6 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
-	"log"
 	"mime/multipart"
 	"net/http"
 	"os"
@@ -50,6 +50,11 @@ func PostForm(url string, obj string) ([]byte, error) {
 
 //PostJSON post json 数据请求
 func PostJSON(uri string, obj interface{}) ([]byte, error) {
+	return PostJSONWithContext(context.Background(), http.DefaultClient, uri, obj)
+}
+
+//PostJSONWithContext 使用指定连接 post json 数据请求 ctx 取消或超时时中断请求
+func PostJSONWithContext(ctx context.Context, client Doer, uri string, obj interface{}) ([]byte, error) {
 	jsonData, err := json.Marshal(obj)
 	if err != nil {
 		return nil, err
@@ -59,14 +64,19 @@ func PostJSON(uri string, obj interface{}) ([]byte, error) {
 	jsonData = bytes.Replace(jsonData, []byte("\\u003e"), []byte(">"), -1)
 	jsonData = bytes.Replace(jsonData, []byte("\\u0026"), []byte("&"), -1)
 	body := bytes.NewBuffer(jsonData)
-	response, err := http.Post(uri, "application/json;charset=utf-8", body)
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, uri, body)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/json;charset=utf-8")
+	response, err := client.Do(request)
 	if err != nil {
 		return nil, err
 	}
 	defer response.Body.Close()
 
 	if response.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("http get error : uri=%v , statusCode=%v", uri, response.StatusCode)
+		return nil, &StatusError{Uri: uri, StatusCode: response.StatusCode}
 	}
 	return ioutil.ReadAll(response.Body)
 }
@@ -196,7 +206,10 @@ func httpWithTLS(rootCa, key string) (*http.Client, error) {
 	if err != nil {
 		return nil, fmt.Errorf("unable to find cert path=%s, error=%v", rootCa, err)
 	}
-	cert := pkcs12ToPem(certData, key)
+	cert, err := pkcs12ToPem(certData, key)
+	if err != nil {
+		return nil, err
+	}
 	config := &tls.Config{
 		Certificates: []tls.Certificate{cert},
 	}
@@ -209,25 +222,20 @@ func httpWithTLS(rootCa, key string) (*http.Client, error) {
 }
 
 //pkcs12ToPem 将Pkcs12转成Pem
-func pkcs12ToPem(p12 []byte, password string) tls.Certificate {
+func pkcs12ToPem(p12 []byte, password string) (cert tls.Certificate, err error) {
 	blocks, err := pkcs12.ToPEM(p12, password)
-	defer func() {
-		if x := recover(); x != nil {
-			log.Print(x)
-		}
-	}()
 	if err != nil {
-		panic(err)
+		return cert, fmt.Errorf("pkcs12 证书解析失败, error=%v", err)
 	}
 	var pemData []byte
 	for _, b := range blocks {
 		pemData = append(pemData, pem.EncodeToMemory(b)...)
 	}
-	cert, err := tls.X509KeyPair(pemData, pemData)
+	cert, err = tls.X509KeyPair(pemData, pemData)
 	if err != nil {
-		panic(err)
+		return cert, fmt.Errorf("pkcs12 证书转换失败, error=%v", err)
 	}
-	return cert
+	return cert, nil
 }
 
 //PostXMLWithTLS perform a HTTP/POST request with XML body and TLS
@@ -0,0 +1,34 @@
+package util
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+)
+
+// ErrPathNotAllowed 文件路径不在允许目录内
+var ErrPathNotAllowed = errors.New("vipspt file path not allowed")
+
+// AllowedPath 允许目录内的文件路径 相对路径基于 dir 解析符号链接后必须位于 dir 内 dir 为空时禁用
+func AllowedPath(dir, name string) (string, error) {
+	if dir == "" {
+		return "", ErrPathNotAllowed
+	}
+	base, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", err
+	}
+	path := name
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	path, err = filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(base, path)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", ErrPathNotAllowed
+	}
+	return path, nil
+}
@@ -12,11 +12,7 @@ import (
 	"hash"
 	"io/ioutil"
 	"net/url"
-	"sort"
-	"strconv"
 	"strings"
-
-	"github.com/shopspring/decimal"
 )
 
 const (
@@ -30,12 +26,11 @@ func VerifySign(signData string, sign string, pubCer string, pubData string, sig
 	var (
 		h     hash.Hash
 		hashs crypto.Hash
-		// block     *pem.Block
-		// pubKey    interface{}
-		// publicKey *rsa.PublicKey
-		// keyOk     bool
 	)
-	signBytes, _ := base64.StdEncoding.DecodeString(sign)
+	signBytes, err := base64.StdEncoding.DecodeString(sign)
+	if err != nil {
+		return ok, fmt.Errorf("sign 转码错误, error=%v", err)
+	}
 	var certD []byte
 	if pubCer != "" {
 		certD, err = ioutil.ReadFile(pubCer)
@@ -44,16 +39,19 @@ func VerifySign(signData string, sign string, pubCer string, pubData string, sig
 		}
 	}
 	if pubData != "" {
-		certD, err = base64.StdEncoding.DecodeString(pubData)
-		if err != nil {
-			return ok, fmt.Errorf("certData 公钥文件转码错误, error=%v", err)
+		if strings.HasPrefix(pubData, "-----BEGIN") {
+			certD = []byte(pubData)
+		} else {
+			certD, err = base64.StdEncoding.DecodeString(pubData)
+			if err != nil {
+				return ok, fmt.Errorf("certData 公钥文件转码错误, error=%v", err)
+			}
 		}
 	}
-	// block, _ := pem.Decode(certD) // .pem
-	_, rest := pem.Decode(certD) // .cer
-	var cert *x509.Certificate
-	cert, _ = x509.ParseCertificate(rest)
-	publicKey := cert.PublicKey.(*rsa.PublicKey)
+	publicKey, err := ParsePublicKey(certD)
+	if err != nil {
+		return ok, err
+	}
 	switch signType {
 	case "RSA":
 		hashs = crypto.SHA1
@@ -71,28 +69,70 @@ func VerifySign(signData string, sign string, pubCer string, pubData string, sig
 	return true, err
 }
 
-// EncodeSignParams 编码符号参数
-func EncodeSignParams(params map[string]interface{}) string {
-	var buf strings.Builder
-	keys := make([]string, 0, len(params))
-	for k := range params {
-		if k == "sign" {
+// ParsePublicKey 解析公钥 支持证书(.cer .pem)、PKIX 及 PKCS1 公钥
+func ParsePublicKey(certD []byte) (publicKey *rsa.PublicKey, err error) {
+	if block, _ := pem.Decode(certD); block != nil {
+		certD = block.Bytes
+	}
+	if cert, err := x509.ParseCertificate(certD); err == nil {
+		if publicKey, ok := cert.PublicKey.(*rsa.PublicKey); ok {
+			return publicKey, nil
+		}
+		return nil, fmt.Errorf("证书公钥不是 RSA 公钥")
+	}
+	if pub, err := x509.ParsePKIXPublicKey(certD); err == nil {
+		if publicKey, ok := pub.(*rsa.PublicKey); ok {
+			return publicKey, nil
+		}
+		return nil, fmt.Errorf("公钥不是 RSA 公钥")
+	}
+	if publicKey, err = x509.ParsePKCS1PublicKey(certD); err == nil {
+		return publicKey, nil
+	}
+	return nil, fmt.Errorf("公钥解析失败, error=%v", err)
+}
+
+// VerifyDataSign 按签名类型验证 vipspt 返回数据 data 中的 sSignature 签名
+// key 为平台公钥 摘要签名类型时为商户密钥
+func VerifyDataSign(data map[string]interface{}, signType string, key string) (err error) {
+	sign, ok := data["sSignature"].(string)
+	if !ok || sign == "" {
+		return fmt.Errorf("sSignature 签名不存在")
+	}
+	params := make(map[string]interface{}, len(data))
+	for k, v := range data {
+		if k == "sSignature" {
 			continue
 		}
-		keys = append(keys, k)
+		params[k] = v
+	}
+	if len(params) == 0 {
+		return fmt.Errorf("签名数据为空")
 	}
-	sort.Strings(keys)
-	for _, k := range keys {
-		v := params[k]
-		if v == "" {
+	verifier, err := NewVerifier(signType, key)
+	if err != nil {
+		return err
+	}
+	return verifier.Verify(params, sign)
+}
+
+// VerifyDataSignKeys 依次使用密钥验证 sSignature 签名 返回验证通过的密钥序号
+func VerifyDataSignKeys(data map[string]interface{}, signType string, keys ...string) (index int, err error) {
+	err = fmt.Errorf("verify key is empty")
+	for i, key := range keys {
+		if key == "" {
 			continue
 		}
-		buf.WriteString(k)
-		buf.WriteByte('=')
-		buf.WriteString(InterfaceToString(v))
-		buf.WriteByte('&')
+		if err = VerifyDataSign(data, signType, key); err == nil {
+			return i, nil
+		}
 	}
-	return buf.String()[:buf.Len()-1]
+	return -1, err
+}
+
+// EncodeSignParams 编码符号参数 空值(nil 及空字符串)不参与签名
+func EncodeSignParams(params map[string]interface{}) string {
+	return encodeSignParams(params, true)
 }
 
 // Sign 开发平台签名支付签名.
@@ -105,23 +145,9 @@ func Sign(params map[string]interface{}, secretKey string) (sign string, err err
 	return sign, nil
 }
 
-// ParseNotifyResult 解析异步通知
+// InterfaceToString 转换为签名字符串 规则见 canonical.go
 func InterfaceToString(v interface{}) string {
-	switch v.(type) {
-	case string:
-		return v.(string)
-	case int:
-		return strconv.Itoa(v.(int))
-	case int64:
-		return strconv.FormatInt(v.(int64), 10)
-	case float32:
-		return strconv.FormatFloat(v.(float64), 'f', -1, 32)
-	case float64:
-		return strconv.FormatFloat(v.(float64), 'f', -1, 64)
-	case decimal.Decimal:
-		return v.(decimal.Decimal).String()
-	}
-	return ""
+	return canonicalString(v)
 }
 
 // FormatPrivateKey 格式化 普通应用秘钥
@@ -161,26 +187,7 @@ func FormatURLParam(params map[string]interface{}) (urlParam string) {
 	return v.Encode()
 }
 
-// EncodeSignParams 编码符号参数
+// EncodeSignParamsNotEmpty 编码符号参数 空值以 key= 参与签名
 func EncodeSignParamsNotEmpty(params map[string]interface{}) string {
-	var buf strings.Builder
-	keys := make([]string, 0, len(params))
-	for k := range params {
-		if k == "sign" {
-			continue
-		}
-		keys = append(keys, k)
-	}
-	sort.Strings(keys)
-	for _, k := range keys {
-		v := params[k]
-		// if v == "" {
-		// 	continue
-		// }
-		buf.WriteString(k)
-		buf.WriteByte('=')
-		buf.WriteString(InterfaceToString(v))
-		buf.WriteByte('&')
-	}
-	return buf.String()[:buf.Len()-1]
+	return encodeSignParams(params, false)
 }
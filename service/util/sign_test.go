@@ -0,0 +1,100 @@
+package util
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+// signVectors 签名串测试向量 sign 为 SHA256 密钥 secret 的签名
+var signVectors = []struct {
+	name   string
+	params map[string]interface{}
+	encode string
+	sign   string
+}{
+	{
+		name:   "empty",
+		params: map[string]interface{}{},
+		encode: "",
+		sign:   "2BB80D537B1DA3E38BD30361AA855686BDE0EACD7162FEF6A25FE97BF527A25B",
+	},
+	{
+		name: "pay",
+		params: map[string]interface{}{
+			"merchant_id":   "307989950941205",
+			"enterpriseReg": "NKOt4Ygx",
+			"pay_way":       "WXZF",
+			"out_order_id":  "513457061273811891",
+			"sAuthCode":     "132421935747150471",
+			"amount":        decimal.NewFromFloat(1).Div(decimal.NewFromFloat(100)),
+			"date_time":     "2022-10-11 11:13:51",
+			"sign":          "IGNORED",
+		},
+		encode: "amount=0.01&date_time=2022-10-11 11:13:51&enterpriseReg=NKOt4Ygx&merchant_id=307989950941205&out_order_id=513457061273811891&pay_way=WXZF&sAuthCode=132421935747150471",
+		sign:   "961BB644E9A2368D65A4FA9683897841CE95CD6D52BC4A92212861DD900B5530",
+	},
+	{
+		name: "empty values",
+		params: map[string]interface{}{
+			"a": "",
+			"b": nil,
+			"c": "1",
+		},
+		encode: "c=1",
+		sign:   "0857B08593E69A8D8E73BBAED226DCDA3A29BDE62A751D33DB2B1E3D2EC56C9A",
+	},
+	{
+		name: "scalars",
+		params: map[string]interface{}{
+			"bool":    true,
+			"int32":   int32(-7),
+			"int64":   int64(1665458031000),
+			"uint":    uint(7),
+			"uint64":  uint64(18446744073709551615),
+			"float32": float32(0.1),
+			"float64": 0.01,
+			"number":  json.Number("12.50"),
+		},
+		encode: "bool=true&float32=0.1&float64=0.01&int32=-7&int64=1665458031000&number=12.50&uint=7&uint64=18446744073709551615",
+		sign:   "CFEF80B7934937708C9C52B0F319FDC70382CA07436C4F39B18DB37752E06FF7",
+	},
+	{
+		name: "nested",
+		params: map[string]interface{}{
+			"goods": []interface{}{
+				map[string]interface{}{"name": "A&B<1>", "price": 1, "id": "g1"},
+			},
+			"extra": map[string]interface{}{"z": false, "a": []int{}},
+			"empty": map[string]interface{}{},
+		},
+		encode: `empty={}&extra={"a":[],"z":false}&goods=[{"id":"g1","name":"A&B<1>","price":1}]`,
+		sign:   "39F87D25A7097CC1F0E88879398B5D5F983240FC8A7CFCF483D3B99D2CCC56EA",
+	},
+}
+
+func TestEncodeSignParams(t *testing.T) {
+	for _, v := range signVectors {
+		if got := EncodeSignParams(v.params); got != v.encode {
+			t.Errorf("%s: EncodeSignParams = %q, want %q", v.name, got, v.encode)
+		}
+		sign, err := Sign(v.params, "secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sign != v.sign {
+			t.Errorf("%s: Sign = %s, want %s", v.name, sign, v.sign)
+		}
+	}
+}
+
+func TestEncodeSignParamsNotEmpty(t *testing.T) {
+	params := map[string]interface{}{"a": "", "b": nil, "c": "1"}
+	if got, want := EncodeSignParamsNotEmpty(params), "a=&b=&c=1"; got != want {
+		t.Errorf("EncodeSignParamsNotEmpty = %q, want %q", got, want)
+	}
+	if got := EncodeSignParamsNotEmpty(map[string]interface{}{}); got != "" {
+		t.Errorf("EncodeSignParamsNotEmpty empty = %q", got)
+	}
+}
@@ -0,0 +1,244 @@
+package util
+
+import (
+	"crypto"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"hash"
+	"strings"
+
+	"github.com/tjfoc/gmsm/sm2"
+	"github.com/tjfoc/gmsm/sm3"
+	gmx509 "github.com/tjfoc/gmsm/x509"
+)
+
+const (
+	SignType_RSA  = "RSA"
+	SignType_RSA2 = "RSA2"
+	SignType_SM2  = "SM2"
+	SignType_SM3  = "SM3"
+)
+
+// Signer 请求参数签名
+type Signer interface {
+	Sign(params map[string]interface{}) (sign string, err error)
+}
+
+// Verifier 签名验证
+type Verifier interface {
+	Verify(params map[string]interface{}, sign string) (err error)
+}
+
+// NewSigner 根据签名类型创建签名 默认 SHA256
+// MD5 SHA1 SHA256 SM3 key 为商户密钥, RSA2 SM2 key 为商户私钥
+func NewSigner(signType string, key string) (Signer, error) {
+	switch strings.ToUpper(signType) {
+	case SignType_MD5:
+		return &hashSigner{hash: md5.New, secretKey: key}, nil
+	case SignType_SHA1:
+		return &hashSigner{hash: sha1.New, secretKey: key}, nil
+	case SignType_SHA256, "":
+		return &hashSigner{hash: sha256.New, secretKey: key}, nil
+	case SignType_SM3:
+		return &hashSigner{hash: sm3.New, secretKey: key}, nil
+	case SignType_RSA2:
+		privateKey, err := ParsePrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		return &rsaSigner{privateKey: privateKey}, nil
+	case SignType_SM2:
+		privateKey, err := ParseSm2PrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		return &sm2Signer{privateKey: privateKey}, nil
+	}
+	return nil, fmt.Errorf("暂不支持签名类型:%s", signType)
+}
+
+// NewVerifier 根据签名类型创建签名验证 默认 RSA(SHA1WithRSA) 与平台 sSignature 一致
+// MD5 SHA1 SHA256 SM3 key 为商户密钥, RSA RSA2 SM2 key 为平台公钥
+func NewVerifier(signType string, key string) (Verifier, error) {
+	switch strings.ToUpper(signType) {
+	case SignType_MD5, SignType_SHA1, SignType_SHA256, SignType_SM3:
+		signer, err := NewSigner(signType, key)
+		if err != nil {
+			return nil, err
+		}
+		return signer.(*hashSigner), nil
+	case SignType_RSA, "":
+		return newRsaVerifier(key, crypto.SHA1)
+	case SignType_RSA2:
+		return newRsaVerifier(key, crypto.SHA256)
+	case SignType_SM2:
+		publicKey, err := ParseSm2PublicKey(key)
+		if err != nil {
+			return nil, err
+		}
+		return &sm2Verifier{publicKey: publicKey}, nil
+	}
+	return nil, fmt.Errorf("暂不支持签名类型:%s", signType)
+}
+
+// SecretSignType 摘要签名类型 仅用于请求签名 返回数据及通知使用平台公钥验签
+func SecretSignType(signType string) bool {
+	switch strings.ToUpper(signType) {
+	case SignType_MD5, SignType_SHA1, SignType_SHA256, SignType_SM3:
+		return true
+	}
+	return false
+}
+
+// hashSigner 摘要签名 sign = 大写 hex(hash(参数 + 密钥))
+type hashSigner struct {
+	hash      func() hash.Hash
+	secretKey string
+}
+
+func (s *hashSigner) Sign(params map[string]interface{}) (sign string, err error) {
+	h := s.hash()
+	h.Write([]byte(EncodeSignParams(params) + s.secretKey))
+	return strings.ToUpper(hex.EncodeToString(h.Sum(nil))), nil
+}
+
+func (s *hashSigner) Verify(params map[string]interface{}, sign string) (err error) {
+	expected, err := s.Sign(params)
+	if err != nil {
+		return err
+	}
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(strings.ToUpper(sign))) != 1 {
+		return fmt.Errorf("签名验证失败")
+	}
+	return nil
+}
+
+// rsaSigner SHA256WithRSA 签名
+type rsaSigner struct {
+	privateKey *rsa.PrivateKey
+}
+
+func (s *rsaSigner) Sign(params map[string]interface{}) (sign string, err error) {
+	sum := sha256.Sum256([]byte(EncodeSignParams(params)))
+	b, err := rsa.SignPKCS1v15(rand.Reader, s.privateKey, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+// rsaVerifier RSA 验签 hash 为 SHA1(RSA) 或 SHA256(RSA2)
+type rsaVerifier struct {
+	publicKey *rsa.PublicKey
+	hash      crypto.Hash
+}
+
+func newRsaVerifier(key string, hash crypto.Hash) (*rsaVerifier, error) {
+	certD, err := decodeKey(key)
+	if err != nil {
+		return nil, err
+	}
+	publicKey, err := ParsePublicKey(certD)
+	if err != nil {
+		return nil, err
+	}
+	return &rsaVerifier{publicKey: publicKey, hash: hash}, nil
+}
+
+func (v *rsaVerifier) Verify(params map[string]interface{}, sign string) (err error) {
+	b, err := base64.StdEncoding.DecodeString(sign)
+	if err != nil {
+		return fmt.Errorf("sign 转码错误, error=%v", err)
+	}
+	h := v.hash.New()
+	h.Write([]byte(EncodeSignParams(params)))
+	return rsa.VerifyPKCS1v15(v.publicKey, v.hash, h.Sum(nil), b)
+}
+
+// sm2Signer SM2withSM3 签名
+type sm2Signer struct {
+	privateKey *sm2.PrivateKey
+}
+
+func (s *sm2Signer) Sign(params map[string]interface{}) (sign string, err error) {
+	b, err := s.privateKey.Sign(rand.Reader, []byte(EncodeSignParams(params)), nil)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+// sm2Verifier SM2withSM3 验签
+type sm2Verifier struct {
+	publicKey *sm2.PublicKey
+}
+
+func (v *sm2Verifier) Verify(params map[string]interface{}, sign string) (err error) {
+	b, err := base64.StdEncoding.DecodeString(sign)
+	if err != nil {
+		return fmt.Errorf("sign 转码错误, error=%v", err)
+	}
+	if !v.publicKey.Verify([]byte(EncodeSignParams(params)), b) {
+		return fmt.Errorf("签名验证失败")
+	}
+	return nil
+}
+
+// decodeKey 密钥支持 PEM 文本或 base64 DER
+func decodeKey(key string) ([]byte, error) {
+	if strings.HasPrefix(key, "-----BEGIN") {
+		return []byte(key), nil
+	}
+	b, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, fmt.Errorf("密钥转码错误, error=%v", err)
+	}
+	return b, nil
+}
+
+// ParsePrivateKey 解析 RSA 私钥 支持 PKCS1 及 PKCS8
+func ParsePrivateKey(key string) (privateKey *rsa.PrivateKey, err error) {
+	keyD, err := decodeKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if block, _ := pem.Decode(keyD); block != nil {
+		keyD = block.Bytes
+	}
+	if privateKey, err = x509.ParsePKCS1PrivateKey(keyD); err == nil {
+		return privateKey, nil
+	}
+	pk, err := x509.ParsePKCS8PrivateKey(keyD)
+	if err != nil {
+		return nil, fmt.Errorf("私钥解析失败, error=%v", err)
+	}
+	if privateKey, ok := pk.(*rsa.PrivateKey); ok {
+		return privateKey, nil
+	}
+	return nil, fmt.Errorf("私钥不是 RSA 私钥")
+}
+
+// ParseSm2PrivateKey 解析 SM2 私钥 支持 PEM 及 hex
+func ParseSm2PrivateKey(key string) (*sm2.PrivateKey, error) {
+	if strings.HasPrefix(key, "-----BEGIN") {
+		return gmx509.ReadPrivateKeyFromPem([]byte(key), nil)
+	}
+	return gmx509.ReadPrivateKeyFromHex(key)
+}
+
+// ParseSm2PublicKey 解析 SM2 公钥 支持 PEM 及 hex
+func ParseSm2PublicKey(key string) (*sm2.PublicKey, error) {
+	if strings.HasPrefix(key, "-----BEGIN") {
+		return gmx509.ReadPublicKeyFromPem([]byte(key))
+	}
+	return gmx509.ReadPublicKeyFromHex(key)
+}
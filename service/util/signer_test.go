@@ -0,0 +1,112 @@
+package util
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"testing"
+
+	"github.com/tjfoc/gmsm/sm2"
+	gmx509 "github.com/tjfoc/gmsm/x509"
+)
+
+// testRsaKey 生成 RSA 密钥 返回 PEM 私钥及公钥
+func testRsaKey(t *testing.T) (string, string) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub}))
+}
+
+// testSm2Key 生成 SM2 密钥 返回 PEM 私钥及公钥
+func testSm2Key(t *testing.T) (string, string) {
+	key, err := sm2.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	priv, err := gmx509.WritePrivateKeyToPem(key, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := gmx509.WritePublicKeyToPem(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(priv), string(pub)
+}
+
+func TestSignerVerifierRoundTrip(t *testing.T) {
+	rsaPriv, rsaPub := testRsaKey(t)
+	sm2Priv, sm2Pub := testSm2Key(t)
+	tests := []struct {
+		signType  string
+		signKey   string
+		verifyKey string
+	}{
+		{SignType_MD5, "secret", "secret"},
+		{SignType_SHA1, "secret", "secret"},
+		{SignType_SHA256, "secret", "secret"},
+		{SignType_SM3, "secret", "secret"},
+		{SignType_RSA2, rsaPriv, rsaPub},
+		{SignType_SM2, sm2Priv, sm2Pub},
+	}
+	params := map[string]interface{}{"out_order_id": "1", "amount": "0.01", "pay_way": "WXZF"}
+	for _, tt := range tests {
+		signer, err := NewSigner(tt.signType, tt.signKey)
+		if err != nil {
+			t.Fatalf("%s NewSigner: %v", tt.signType, err)
+		}
+		sign, err := signer.Sign(params)
+		if err != nil {
+			t.Fatalf("%s Sign: %v", tt.signType, err)
+		}
+		verifier, err := NewVerifier(tt.signType, tt.verifyKey)
+		if err != nil {
+			t.Fatalf("%s NewVerifier: %v", tt.signType, err)
+		}
+		if err := verifier.Verify(params, sign); err != nil {
+			t.Errorf("%s Verify: %v", tt.signType, err)
+		}
+		tampered := map[string]interface{}{"out_order_id": "1", "amount": "100.00", "pay_way": "WXZF"}
+		if err := verifier.Verify(tampered, sign); err == nil {
+			t.Errorf("%s Verify tampered params passed", tt.signType)
+		}
+	}
+}
+
+func TestVerifyDataSignRSA(t *testing.T) {
+	rsaPriv, rsaPub := testRsaKey(t)
+	key, err := ParsePrivateKey(rsaPriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := map[string]interface{}{"out_order_id": "1", "status": "2"}
+	sum := sha1.Sum([]byte(EncodeSignParams(data)))
+	b, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA1, sum[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	data["sSignature"] = base64.StdEncoding.EncodeToString(b)
+	// 签名类型为空及 RSA 均为 SHA1WithRSA
+	for _, signType := range []string{"", SignType_RSA} {
+		if err := VerifyDataSign(data, signType, rsaPub); err != nil {
+			t.Errorf("%q: %v", signType, err)
+		}
+	}
+	if err := VerifyDataSign(data, SignType_RSA2, rsaPub); err == nil {
+		t.Error("RSA2 verified a SHA1 signature")
+	}
+	if _, err := VerifyDataSignKeys(data, "", ""); err == nil {
+		t.Error("empty key passed")
+	}
+}
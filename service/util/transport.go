@@ -0,0 +1,267 @@
+package util
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Doer 执行 HTTP 请求 *http.Client 即实现 测试时可替换
+type Doer interface {
+	Do(request *http.Request) (*http.Response, error)
+}
+
+// HTTPOptions HTTP 连接配置
+type HTTPOptions struct {
+	CaBundle     string   // 自定义 CA 证书 PEM 文本或文件路径
+	Pins         []string // 证书公钥锁定 base64(sha256(SPKI))
+	Cert         string   // 客户端证书 PKCS#12 文件路径或 base64, PEM 文本或文件路径
+	CertKey      string   // PEM 证书私钥 文本或文件路径 为空时 Cert 为 PKCS#12
+	CertPassword string   // PKCS#12 证书密码
+	CertDir      string   // 证书文件允许目录 为空时 Cert CertKey 不接受文件路径
+
+	ConnectTimeout      time.Duration // 连接超时 默认 5s
+	ReadTimeout         time.Duration // 等待响应超时 默认 30s
+	Timeout             time.Duration // 请求总超时 默认 60s
+	MaxIdleConns        int           // 最大空闲连接 默认 100
+	MaxIdleConnsPerHost int           // 每个主机最大空闲连接 默认 20
+	Proxy               string        // HTTP 代理 为空时使用环境变量 HTTP_PROXY
+	KeepAlive           time.Duration // TCP keep-alive 间隔 默认 30s 小于 0 时禁用连接复用
+}
+
+// StatusError 网关返回非 200 状态码
+type StatusError struct {
+	Uri        string
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("http get error : uri=%v , statusCode=%v", e.Uri, e.StatusCode)
+}
+
+// ErrPinMismatch 证书公钥锁定校验失败
+var ErrPinMismatch = errors.New("vipspt 证书公钥锁定校验失败")
+
+// HTTPClientTTL 连接缓存有效期 到期后重新加载证书 超过有效期未使用的连接被清理
+var HTTPClientTTL = 5 * time.Minute
+
+type httpClientEntry struct {
+	client *http.Client
+	loaded time.Time
+	used   time.Time
+}
+
+var (
+	httpClientsMu sync.Mutex
+	httpClients   = map[string]*httpClientEntry{}
+)
+
+// HTTPClient 获取 HTTP 连接 相同配置复用连接池及已加载的客户端证书
+func HTTPClient(opts HTTPOptions) (*http.Client, error) {
+	key, err := httpClientKey(opts)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	httpClientsMu.Lock()
+	defer httpClientsMu.Unlock()
+	if entry, ok := httpClients[key]; ok && now.Sub(entry.loaded) < HTTPClientTTL {
+		entry.used = now
+		return entry.client, nil
+	}
+	client, err := NewHTTPClient(opts)
+	if err != nil {
+		return nil, err
+	}
+	if old, ok := httpClients[key]; ok {
+		closeIdleConnections(old.client)
+	}
+	httpClients[key] = &httpClientEntry{client: client, loaded: now, used: now}
+	// 清理过期未使用的连接
+	for k, entry := range httpClients {
+		if k != key && now.Sub(entry.used) >= HTTPClientTTL {
+			closeIdleConnections(entry.client)
+			delete(httpClients, k)
+		}
+	}
+	return client, nil
+}
+
+// closeIdleConnections 关闭空闲连接 进行中的请求不受影响
+func closeIdleConnections(client *http.Client) {
+	if tr, ok := client.Transport.(*http.Transport); ok {
+		tr.CloseIdleConnections()
+	}
+}
+
+// httpClientKey 连接池 key 为配置摘要 避免证书密码等以明文常驻内存
+func httpClientKey(opts HTTPOptions) (string, error) {
+	b, err := json.Marshal(opts)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// NewHTTPClient 创建 HTTP 连接
+func NewHTTPClient(opts HTTPOptions) (*http.Client, error) {
+	config, err := NewTLSConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.ConnectTimeout == 0 {
+		opts.ConnectTimeout = 5 * time.Second
+	}
+	if opts.ReadTimeout == 0 {
+		opts.ReadTimeout = 30 * time.Second
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = 60 * time.Second
+	}
+	if opts.MaxIdleConns == 0 {
+		opts.MaxIdleConns = 100
+	}
+	if opts.MaxIdleConnsPerHost == 0 {
+		opts.MaxIdleConnsPerHost = 20
+	}
+	if opts.KeepAlive == 0 {
+		opts.KeepAlive = 30 * time.Second
+	}
+	proxy := http.ProxyFromEnvironment
+	if opts.Proxy != "" {
+		proxyUrl, err := url.Parse(opts.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("proxy 地址错误, error=%v", err)
+		}
+		proxy = http.ProxyURL(proxyUrl)
+	}
+	dialer := &net.Dialer{
+		Timeout:   opts.ConnectTimeout,
+		KeepAlive: opts.KeepAlive,
+	}
+	tr := &http.Transport{
+		Proxy:                 proxy,
+		DialContext:           dialer.DialContext,
+		TLSClientConfig:       config,
+		TLSHandshakeTimeout:   opts.ConnectTimeout,
+		ResponseHeaderTimeout: opts.ReadTimeout,
+		MaxIdleConns:          opts.MaxIdleConns,
+		MaxIdleConnsPerHost:   opts.MaxIdleConnsPerHost,
+		IdleConnTimeout:       90 * time.Second,
+		ExpectContinueTimeout: time.Second,
+		DisableKeepAlives:     opts.KeepAlive < 0,
+	}
+	return &http.Client{
+		Transport: tr,
+		Timeout:   opts.Timeout,
+	}, nil
+}
+
+// NewTLSConfig 创建 TLS 配置 支持自定义 CA 及 SPKI 证书锁定
+func NewTLSConfig(opts HTTPOptions) (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+	if opts.CaBundle != "" {
+		caData := []byte(opts.CaBundle)
+		if !strings.HasPrefix(opts.CaBundle, "-----BEGIN") {
+			data, err := ioutil.ReadFile(opts.CaBundle)
+			if err != nil {
+				return nil, fmt.Errorf("unable to find ca bundle path=%s, error=%v", opts.CaBundle, err)
+			}
+			caData = data
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caData) {
+			return nil, fmt.Errorf("ca bundle 未找到有效证书")
+		}
+		config.RootCAs = pool
+	}
+	if opts.Cert != "" {
+		cert, err := LoadClientCertificate(opts.Cert, opts.CertKey, opts.CertPassword, opts.CertDir)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	if len(opts.Pins) > 0 {
+		pins := map[string]bool{}
+		for _, pin := range opts.Pins {
+			pins[strings.TrimSpace(pin)] = true
+		}
+		// 证书链验证通过后 链中任一证书公钥匹配即通过
+		config.VerifyPeerCertificate = func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+			for _, chain := range verifiedChains {
+				for _, cert := range chain {
+					sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+					if pins[base64.StdEncoding.EncodeToString(sum[:])] {
+						return nil
+					}
+				}
+			}
+			return ErrPinMismatch
+		}
+	}
+	return config, nil
+}
+
+// LoadClientCertificate 加载客户端证书 key 为空时 cert 为 PKCS#12 文件路径须位于 dir 内
+func LoadClientCertificate(cert, key, password, dir string) (tls.Certificate, error) {
+	if key != "" {
+		certData, err := readPEM(cert, dir)
+		if err != nil {
+			return tls.Certificate{}, err
+		}
+		keyData, err := readPEM(key, dir)
+		if err != nil {
+			return tls.Certificate{}, err
+		}
+		c, err := tls.X509KeyPair(certData, keyData)
+		if err != nil {
+			return c, fmt.Errorf("客户端证书解析失败, error=%v", err)
+		}
+		return c, nil
+	}
+	p12, err := readFile(cert, dir)
+	if err != nil {
+		p12, err = base64.StdEncoding.DecodeString(cert)
+		if err != nil {
+			return tls.Certificate{}, fmt.Errorf("unable to find cert path=%s", cert)
+		}
+	}
+	return pkcs12ToPem(p12, password)
+}
+
+// readPEM PEM 文本或 dir 内文件路径
+func readPEM(v, dir string) ([]byte, error) {
+	if strings.HasPrefix(v, "-----BEGIN") {
+		return []byte(v), nil
+	}
+	data, err := readFile(v, dir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to find cert path=%s, error=%v", v, err)
+	}
+	return data, nil
+}
+
+// readFile 读取 dir 内文件
+func readFile(name, dir string) ([]byte, error) {
+	path, err := AllowedPath(dir, name)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(path)
+}
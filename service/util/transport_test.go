@@ -0,0 +1,268 @@
+package util
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testServerCA httptest 服务证书 PEM 及 SPKI 锁定值
+func testServerCA(server *httptest.Server) (ca string, pin string) {
+	cert := server.Certificate()
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	ca = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}))
+	return ca, base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func TestHTTPClientPins(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ok")
+	}))
+	defer server.Close()
+	ca, pin := testServerCA(server)
+
+	tests := []struct {
+		name string
+		pins []string
+		ok   bool
+	}{
+		{"no pins", nil, true},
+		{"match", []string{"AAAA", " " + pin}, true},
+		{"mismatch", []string{base64.StdEncoding.EncodeToString(make([]byte, 32))}, false},
+	}
+	for _, tt := range tests {
+		client, err := NewHTTPClient(HTTPOptions{CaBundle: ca, Pins: tt.pins})
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := client.Get(server.URL)
+		if err == nil {
+			res.Body.Close()
+		}
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: err = %v, want ok %v", tt.name, err, tt.ok)
+		}
+		if err != nil && !strings.Contains(err.Error(), "证书公钥锁定") {
+			t.Errorf("%s: err = %v, want pin error", tt.name, err)
+		}
+	}
+}
+
+func TestHTTPClientKey(t *testing.T) {
+	key, err := httpClientKey(HTTPOptions{Cert: "cert.p12", CertPassword: "p12-password"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(key, "p12-password") || len(key) != 64 {
+		t.Errorf("key = %s", key)
+	}
+	other, _ := httpClientKey(HTTPOptions{Cert: "cert.p12", CertPassword: "other"})
+	if key == other {
+		t.Error("different options share a key")
+	}
+	a, _ := HTTPClient(HTTPOptions{Pins: []string{"AAAA"}})
+	b, _ := HTTPClient(HTTPOptions{Pins: []string{"AAAA"}})
+	if a != b {
+		t.Error("same options did not share a client")
+	}
+}
+
+// testClientCert 生成自签名客户端证书 返回 PEM 证书及私钥
+func testClientCert(t *testing.T) (certPEM, keyPEM string) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "vipspt-client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	keyPEM = string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+	return certPEM, keyPEM
+}
+
+func TestLoadClientCertificate(t *testing.T) {
+	certPEM, keyPEM := testClientCert(t)
+	dir, err := ioutil.TempDir("", "vipspt-cert")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certPath := filepath.Join(dir, "cert.pem")
+	keyPath := filepath.Join(dir, "key.pem")
+	ioutil.WriteFile(certPath, []byte(certPEM), 0600)
+	ioutil.WriteFile(keyPath, []byte(keyPEM), 0600)
+	// testdata/client.p12 为 openssl 生成的 PKCS#12 证书 密码 secret
+	p12, err := ioutil.ReadFile(filepath.Join("testdata", "client.p12"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p12Path := filepath.Join(dir, "client.p12")
+	ioutil.WriteFile(p12Path, p12, 0600)
+	outside, err := filepath.Abs(filepath.Join("testdata", "client.p12"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	traversal, err := filepath.Rel(dir, outside)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := []struct {
+		name                string
+		cert, key, password string
+	}{
+		{"pem text", certPEM, keyPEM, ""},
+		{"pem file", certPath, keyPath, ""},
+		{"p12 file", p12Path, "", "secret"},
+		{"p12 relative file", "client.p12", "", "secret"},
+		{"p12 base64", base64.StdEncoding.EncodeToString(p12), "", "secret"},
+	}
+	for _, tt := range loaded {
+		cert, err := LoadClientCertificate(tt.cert, tt.key, tt.password, dir)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if len(cert.Certificate) == 0 || cert.PrivateKey == nil {
+			t.Errorf("%s: certificate = %+v", tt.name, cert)
+		}
+	}
+
+	_, otherKey := testClientCert(t)
+	failed := []struct {
+		name                string
+		cert, key, password string
+		msg                 string
+	}{
+		{"missing cert file", filepath.Join(dir, "missing.pem"), keyPath, "", "unable to find cert"},
+		{"missing key file", certPath, filepath.Join(dir, "missing.pem"), "", "unable to find cert"},
+		{"bad cert", "-----BEGIN CERTIFICATE-----\nbad\n-----END CERTIFICATE-----\n", keyPEM, "", "客户端证书解析失败"},
+		{"mismatched key", certPEM, otherKey, "", "客户端证书解析失败"},
+		{"bad p12", base64.StdEncoding.EncodeToString([]byte("bad")), "", "secret", "pkcs12 证书解析失败"},
+		{"wrong password", p12Path, "", "wrong", "pkcs12 证书解析失败"},
+		{"missing p12", "missing.p12", "", "secret", "unable to find cert"},
+		{"p12 outside dir", outside, "", "secret", "unable to find cert"},
+		{"p12 traversal", traversal, "", "secret", "unable to find cert"},
+	}
+	for _, tt := range failed {
+		if _, err := LoadClientCertificate(tt.cert, tt.key, tt.password, dir); err == nil || !strings.Contains(err.Error(), tt.msg) {
+			t.Errorf("%s: err = %v, want %s", tt.name, err, tt.msg)
+		}
+	}
+	// 未配置目录时不接受文件路径
+	if _, err := LoadClientCertificate(certPath, keyPath, "", ""); err == nil || !strings.Contains(err.Error(), "unable to find cert") {
+		t.Errorf("empty dir: err = %v", err)
+	}
+	if _, err := NewHTTPClient(HTTPOptions{Cert: p12Path, CertPassword: "wrong", CertDir: dir}); err == nil {
+		t.Error("NewHTTPClient accepted wrong password")
+	}
+}
+
+func TestHTTPClientReload(t *testing.T) {
+	ttl := HTTPClientTTL
+	defer func() { HTTPClientTTL = ttl }()
+	dir, err := ioutil.TempDir("", "vipspt-cert")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certPath := filepath.Join(dir, "cert.pem")
+	keyPath := filepath.Join(dir, "key.pem")
+	write := func() string {
+		certPEM, keyPEM := testClientCert(t)
+		ioutil.WriteFile(certPath, []byte(certPEM), 0600)
+		ioutil.WriteFile(keyPath, []byte(keyPEM), 0600)
+		return certPEM
+	}
+	loaded := func(client *http.Client) string {
+		der := client.Transport.(*http.Transport).TLSClientConfig.Certificates[0].Certificate[0]
+		return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	}
+	opts := HTTPOptions{Cert: certPath, CertKey: keyPath, CertDir: dir}
+
+	HTTPClientTTL = time.Hour
+	first := write()
+	a, err := HTTPClient(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 有效期内证书文件更新不重新加载
+	write()
+	if b, _ := HTTPClient(opts); b != a || loaded(b) != first {
+		t.Error("client reloaded before ttl")
+	}
+	// 到期后重新加载证书
+	HTTPClientTTL = 0
+	rotated := write()
+	b, err := HTTPClient(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b == a || loaded(b) != rotated {
+		t.Error("rotated certificate not loaded")
+	}
+	// 清理过期未使用的连接
+	if _, err := HTTPClient(HTTPOptions{Pins: []string{"reload"}}); err != nil {
+		t.Fatal(err)
+	}
+	key, _ := httpClientKey(opts)
+	httpClientsMu.Lock()
+	_, ok := httpClients[key]
+	httpClientsMu.Unlock()
+	if ok {
+		t.Error("unused client not evicted")
+	}
+}
+
+func TestHTTPClientCertificate(t *testing.T) {
+	certPEM, keyPEM := testClientCert(t)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) == 0 {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		fmt.Fprint(w, r.TLS.PeerCertificates[0].Subject.CommonName)
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	defer server.Close()
+	ca, _ := testServerCA(server)
+
+	client, err := NewHTTPClient(HTTPOptions{CaBundle: ca, Cert: certPEM, CertKey: keyPEM})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, _ := ioutil.ReadAll(res.Body)
+	if string(body) != "vipspt-client" {
+		t.Errorf("server saw client cert %q", body)
+	}
+}